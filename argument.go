@@ -0,0 +1,79 @@
+package rl
+
+import "strconv"
+
+// maxArg bounds numeric arguments, as readline does.
+const maxArg = 1000000
+
+// digitArgument starts a numeric argument with the digit or minus sign
+// typed with Alt.
+func digitArgument(e *Editor) {
+	e.readArgument(false)
+}
+
+// universalArgument starts a numeric argument of four. Repeating it
+// multiplies the argument by four and digits typed after it replace it.
+func universalArgument(e *Editor) {
+	e.readArgument(true)
+}
+
+// readArgument reads the rest of a numeric argument, showing it in place
+// of the prompt, and leaves it in e.arg for the command that follows.
+func (e *Editor) readArgument(universal bool) {
+	defer e.updateMode()
+
+	n, neg, digits := 1, false, false
+	switch {
+	case universal:
+		n = 4
+	case e.key.Rune == '-':
+		neg = true
+	default:
+		n, digits = int(e.key.Rune-'0'), true
+	}
+
+	for {
+		arg := n
+		if neg {
+			arg = -n
+		}
+		e.c.prompt = "(arg: " + strconv.Itoa(arg) + ") "
+		e.dirty = true
+
+		k, ok := e.nextKey()
+		if !ok {
+			return
+		}
+		switch {
+		case k == ctrlKey('g'):
+			return
+		case k.Code == KeyRune && !k.Ctrl && k.Rune >= '0' && k.Rune <= '9':
+			if !digits {
+				n, digits = 0, true
+			}
+			n = min(n*10+int(k.Rune-'0'), maxArg)
+		case k.Code == KeyRune && !k.Ctrl && k.Rune == '-' && !digits:
+			neg = true
+		case e.isUniversalArgument(k) && !digits:
+			n = min(n*4, maxArg)
+		default:
+			e.arg = arg
+			e.keepArg = true
+			e.keys = append([]Key{k}, e.keys...)
+			return
+		}
+	}
+}
+
+// count returns the numeric argument given to the running command, or 1.
+func (e *Editor) count() int {
+	if e.arg == 0 {
+		return 1
+	}
+	return e.arg
+}
+
+func (e *Editor) isUniversalArgument(k Key) bool {
+	b := e.keymap().bindings[k]
+	return b != nil && b.name == "universal-argument"
+}
@@ -0,0 +1,82 @@
+package rl
+
+import "testing"
+
+func altKeys(s string) []Key {
+	var ks []Key
+	for _, r := range s {
+		ks = append(ks, altKey(r))
+	}
+	return ks
+}
+
+// runKeys runs keys through the editor as readLine would.
+func runKeys(e *Editor, keys ...Key) {
+	e.keys = append(e.keys, keys...)
+	for len(e.keys) > 0 && e.state == stateEditing {
+		k, err := e.readKey()
+		if err != nil {
+			return
+		}
+		e.handleKey(k)
+	}
+}
+
+func TestDigitArgument(t *testing.T) {
+	tests := []struct {
+		input  string
+		cursor int
+		keys   []Key
+		want   string
+		pos    int
+	}{
+		{"abcdef", 1, append(altKeys("3"), ctrlKey('d')), "aef", 1},
+		{"abcdef", 5, append(altKeys("-2"), ctrlKey('d')), "abcf", 3},
+		{"one two three four", 18, append(altKeys("2"), altKey('b')), "one two three four", 8},
+		{"", 0, append(altKeys("1"), typeKeys("2x")...), "xxxxxxxxxxxx", 12},
+		{"", 0, append(altKeys("-"), ctrlKey('f')), "", 0},
+		{"one two three", 13, append(altKeys("2"), Key{Code: KeyBackspace, Alt: true}), "one ", 4},
+	}
+	for _, tt := range tests {
+		e := &Editor{r: NewRl(), c: &ctx{input: newBuffer(tt.input), cursor_x: tt.cursor}}
+		runKeys(e, tt.keys...)
+		if e.c.input.String() != tt.want || e.c.cursor_x != tt.pos {
+			t.Errorf("%q with %v = %q cursor %d, want %q cursor %d",
+				tt.input, tt.keys, e.c.input.String(), e.c.cursor_x, tt.want, tt.pos)
+		}
+		if e.c.prompt != "" || e.arg != 0 {
+			t.Errorf("%q with %v left prompt %q arg %d", tt.input, tt.keys, e.c.prompt, e.arg)
+		}
+	}
+}
+
+func TestUniversalArgument(t *testing.T) {
+	e := &Editor{r: NewRl(), c: &ctx{}}
+	if err := e.r.Keymap.Bind(`\C-u`, "universal-argument"); err != nil {
+		t.Fatal(err)
+	}
+	runKeys(e, ctrlKey('u'), ctrlKey('u'), Key{Rune: 'a'})
+	if e.c.input.String() != "aaaaaaaaaaaaaaaa" {
+		t.Fatalf("C-u C-u a = %q, want 16 a", e.c.input.String())
+	}
+
+	e.SetLine("")
+	runKeys(e, ctrlKey('u'), Key{Rune: '3'}, Key{Rune: 'x'})
+	if e.c.input.String() != "xxx" {
+		t.Fatalf("C-u 3 x = %q, want %q", e.c.input.String(), "xxx")
+	}
+}
+
+func TestArgumentKeptForNextCommand(t *testing.T) {
+	e := &Editor{r: NewRl(), c: &ctx{}, prompt: "> "}
+	e.updateMode()
+	var arg int
+	e.r.Keymap.BindFunc("x", func(e *Editor) { arg = e.arg })
+	runKeys(e, altKey('2'), Key{Rune: '5'}, Key{Rune: 'x'})
+	if arg != 25 {
+		t.Fatalf("arg = %d, want 25", arg)
+	}
+	if e.c.prompt != "> " || e.arg != 0 {
+		t.Fatalf("after the command prompt = %q arg %d, want %q arg 0", e.c.prompt, e.arg, "> ")
+	}
+}
@@ -0,0 +1,238 @@
+package rl
+
+import "slices"
+
+// buffer holds the text of the line in a gap buffer: the runes before the
+// gap, unused space, then the runes after the gap. Insertions and
+// deletions happen at the gap, which is moved to where they are needed, so
+// editing at the cursor costs the same however long the line is.
+type buffer struct {
+	data []rune
+	// data[gap:gapEnd] is the unused space.
+	gap    int
+	gapEnd int
+	// edits lists the changes made since takeEdits was last called.
+	edits []edit
+}
+
+// edit is a change made to a buffer: deleted was removed at pos and
+// inserted put in its place. Undo keeps edits rather than copies of the
+// line, so that recording a change costs as much as the change itself.
+type edit struct {
+	pos      int
+	deleted  []rune
+	inserted []rune
+}
+
+func newBuffer(s string) buffer {
+	var b buffer
+	b.set([]rune(s))
+	b.edits = nil
+	return b
+}
+
+// len returns the number of runes in the buffer.
+func (b *buffer) len() int {
+	return len(b.data) - (b.gapEnd - b.gap)
+}
+
+// at returns the rune at position i.
+func (b *buffer) at(i int) rune {
+	if i >= b.gap {
+		i += b.gapEnd - b.gap
+	}
+	return b.data[i]
+}
+
+// setRune replaces the rune at position i.
+func (b *buffer) setRune(i int, r rune) {
+	if old := b.at(i); old != r {
+		b.edits = append(b.edits, edit{pos: i, deleted: []rune{old}, inserted: []rune{r}})
+	}
+	if i >= b.gap {
+		i += b.gapEnd - b.gap
+	}
+	b.data[i] = r
+}
+
+// runes returns the contents as one slice. It moves the gap to the end and
+// shares the buffer's memory, so it is only valid until the next change.
+func (b *buffer) runes() []rune {
+	b.moveGap(b.len())
+	return b.data[:b.gap:b.gap]
+}
+
+// slice returns a copy of the runes from start to end.
+func (b *buffer) slice(start, end int) []rune {
+	out := make([]rune, 0, end-start)
+	if start < b.gap {
+		out = append(out, b.data[start:min(end, b.gap)]...)
+	}
+	if end > b.gap {
+		gap := b.gapEnd - b.gap
+		out = append(out, b.data[max(start, b.gap)+gap:end+gap]...)
+	}
+	return out
+}
+
+func (b *buffer) String() string {
+	return string(b.slice(0, b.len()))
+}
+
+// set replaces the contents with a copy of rs.
+func (b *buffer) set(rs []rune) {
+	old := b.slice(0, b.len())
+	if slices.Equal(old, rs) {
+		return
+	}
+	b.edits = append(b.edits, edit{deleted: old, inserted: slices.Clone(rs)})
+	b.data = append([]rune(nil), rs...)
+	b.gap, b.gapEnd = len(rs), len(rs)
+}
+
+// insert inserts rs at pos.
+func (b *buffer) insert(pos int, rs ...rune) {
+	b.replace(pos, pos, rs...)
+}
+
+// delete removes the runes from start to end.
+func (b *buffer) delete(start, end int) {
+	b.replace(start, end)
+}
+
+// replace replaces the runes from start to end with rs.
+func (b *buffer) replace(start, end int, rs ...rune) {
+	deleted := b.slice(start, end)
+	if slices.Equal(deleted, rs) {
+		return
+	}
+	b.edits = append(b.edits, edit{pos: start, deleted: deleted, inserted: slices.Clone(rs)})
+	b.moveGap(start)
+	b.gapEnd += end - start
+	b.grow(len(rs))
+	copy(b.data[b.gap:], rs)
+	b.gap += len(rs)
+}
+
+// takeEdits returns the edits made since it was last called.
+func (b *buffer) takeEdits() []edit {
+	edits := b.edits
+	b.edits = nil
+	return edits
+}
+
+// undo reverses ed, which must be the last edit made to the text.
+func (b *buffer) undo(ed edit) {
+	b.replace(ed.pos, ed.pos+len(ed.inserted), ed.deleted...)
+}
+
+// redo makes ed again after undo.
+func (b *buffer) redo(ed edit) {
+	b.replace(ed.pos, ed.pos+len(ed.deleted), ed.inserted...)
+}
+
+// changedBy reports whether edits, the last ones made, changed the text.
+// A single edit always does. After several, as when a search puts back
+// the line it changed, the text is compared with what it was before them.
+func (b *buffer) changedBy(edits []edit) bool {
+	switch len(edits) {
+	case 0:
+		return false
+	case 1:
+		return true
+	}
+	now := b.slice(0, b.len())
+	var before buffer
+	before.set(now)
+	for i := len(edits) - 1; i >= 0; i-- {
+		before.undo(edits[i])
+	}
+	return !slices.Equal(before.runes(), now)
+}
+
+func (b *buffer) moveGap(pos int) {
+	switch {
+	case pos < b.gap:
+		n := b.gap - pos
+		copy(b.data[b.gapEnd-n:b.gapEnd], b.data[pos:b.gap])
+		b.gap -= n
+		b.gapEnd -= n
+	case pos > b.gap:
+		n := pos - b.gap
+		copy(b.data[b.gap:b.gap+n], b.data[b.gapEnd:b.gapEnd+n])
+		b.gap += n
+		b.gapEnd += n
+	}
+}
+
+// grow makes room for at least n runes in the gap, doubling the buffer so
+// that a run of insertions takes amortized constant time per rune.
+func (b *buffer) grow(n int) {
+	if b.gapEnd-b.gap >= n {
+		return
+	}
+	size := max(2*len(b.data), len(b.data)+n, 64)
+	data := make([]rune, size)
+	copy(data, b.data[:b.gap])
+	after := len(b.data) - b.gapEnd
+	copy(data[size-after:], b.data[b.gapEnd:])
+	b.data, b.gapEnd = data, size-after
+}
+
+// deleteBefore deletes the grapheme cluster before cursor and returns the
+// new cursor position. It reports false if there was nothing to delete.
+func (b *buffer) deleteBefore(cursor int) (int, bool) {
+	if cursor <= 0 || cursor > b.len() {
+		return cursor, false
+	}
+	start := prevGrapheme(b, cursor)
+	b.delete(start, cursor)
+	return start, true
+}
+
+// complete replaces the text from completePos to cursor with the common
+// prefix of candidates and returns the new cursor position. It reports
+// false if the line was left alone.
+func (b *buffer) complete(completePos, cursor int, candidates []string, ignoreCase bool) (int, bool) {
+	if len(candidates) == 0 || completePos < 0 || completePos > cursor || cursor > b.len() {
+		return cursor, false
+	}
+
+	item := []rune(commonPrefix(candidates, ignoreCase))
+	if len(item) == 0 {
+		return cursor, false
+	}
+	b.replace(completePos, cursor, item...)
+	return completePos + len(item), true
+}
+
+// transposeChars swaps the character before cursor with the one under it
+// and returns the new cursor position, after both. At the end of the line
+// the last two characters are swapped instead. Characters are grapheme
+// clusters. It reports false if there was nothing to swap.
+func (b *buffer) transposeChars(cursor int) (int, bool) {
+	if cursor <= 0 || cursor > b.len() {
+		return cursor, false
+	}
+	if cursor == b.len() {
+		cursor = prevGrapheme(b, cursor)
+	}
+	start, end := prevGrapheme(b, cursor), nextGrapheme(b, cursor)
+	if start == cursor || end == cursor {
+		return cursor, false
+	}
+	b.replace(start, end, append(b.slice(cursor, end), b.slice(start, cursor)...)...)
+	return end, true
+}
+
+// wordStart returns the start of the whitespace delimited word before
+// cursor, as used by Ctrl-W.
+func (b *buffer) wordStart(cursor int) int {
+	for cursor > 0 && (b.at(cursor-1) == ' ' || b.at(cursor-1) == '\t') {
+		cursor--
+	}
+	for cursor > 0 && b.at(cursor-1) != ' ' && b.at(cursor-1) != '\t' {
+		cursor--
+	}
+	return cursor
+}
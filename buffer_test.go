@@ -0,0 +1,173 @@
+package rl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBufferEdits(t *testing.T) {
+	b := newBuffer("hello world")
+	b.insert(5, ',')
+	b.delete(0, 1)
+	b.insert(0, 'J')
+	b.insert(b.len(), []rune("!!")...)
+	b.delete(6, 7)
+	if got := b.String(); got != "Jello,world!!" {
+		t.Fatalf("String() = %q, want %q", got, "Jello,world!!")
+	}
+	if got := string(b.slice(3, 8)); got != "lo,wo" {
+		t.Fatalf("slice(3, 8) = %q, want %q", got, "lo,wo")
+	}
+	if b.at(5) != ',' || b.at(12) != '!' {
+		t.Fatalf("at(5), at(12) = %q, %q, want ',' and '!'", b.at(5), b.at(12))
+	}
+	b.setRune(0, 'j')
+	if got := string(b.runes()); got != "jello,world!!" {
+		t.Fatalf("runes() = %q, want %q", got, "jello,world!!")
+	}
+}
+
+func TestBufferMatchesSlice(t *testing.T) {
+	var b buffer
+	var want []rune
+	for i := 0; i < 2000; i++ {
+		pos := (i * 7919) % (len(want) + 1)
+		if i%3 == 2 && pos < len(want) {
+			end := min(pos+i%5+1, len(want))
+			b.delete(pos, end)
+			want = append(want[:pos], want[end:]...)
+			continue
+		}
+		r := rune('a' + i%26)
+		b.insert(pos, r)
+		want = append(want[:pos], append([]rune{r}, want[pos:]...)...)
+	}
+	if b.String() != string(want) || b.len() != len(want) {
+		t.Fatalf("buffer = %q, want %q", b.String(), string(want))
+	}
+}
+
+func TestBufferDeleteBefore(t *testing.T) {
+	b := newBuffer("日本語")
+	cursor, ok := b.deleteBefore(2)
+	if !ok || cursor != 1 || b.String() != "日語" {
+		t.Fatalf("deleteBefore = %q, %d, %v, want %q, 1, true", b.String(), cursor, ok, "日語")
+	}
+	if _, ok := b.deleteBefore(0); ok {
+		t.Fatal("deleteBefore(0) reported a deletion")
+	}
+}
+
+func TestBufferCompletePreservesSuffix(t *testing.T) {
+	b := newBuffer("say he world")
+	cursor, ok := b.complete(4, 6, []string{"hello", "help"}, false)
+	if !ok {
+		t.Fatal("complete returned !ok")
+	}
+	if b.String() != "say hel world" {
+		t.Fatalf("complete = %q, want %q", b.String(), "say hel world")
+	}
+	if cursor != 7 {
+		t.Fatalf("complete cursor = %d, want 7", cursor)
+	}
+}
+
+func TestBufferCompleteHandlesUTF8Prefix(t *testing.T) {
+	b := newBuffer("こん")
+	_, ok := b.complete(0, 2, []string{"こんにちは", "こんばんは"}, false)
+	if !ok {
+		t.Fatal("complete returned !ok")
+	}
+	if b.String() != "こん" {
+		t.Fatalf("complete = %q, want %q", b.String(), "こん")
+	}
+}
+
+func TestBufferCompleteIgnoreCase(t *testing.T) {
+	b := newBuffer("cd doc")
+	cursor, ok := b.complete(3, 6, []string{"Documents/", "DOCKER/"}, true)
+	if !ok {
+		t.Fatal("complete returned !ok")
+	}
+	if b.String() != "cd Doc" || cursor != 6 {
+		t.Fatalf("complete = %q, %d, want %q, 6", b.String(), cursor, "cd Doc")
+	}
+}
+
+func TestBufferWordStart(t *testing.T) {
+	b := newBuffer("ls -l\t/tmp/x  ")
+	if got := b.wordStart(b.len()); got != 6 {
+		t.Fatalf("wordStart = %d, want 6", got)
+	}
+}
+
+func TestBufferTransposeChars(t *testing.T) {
+	tests := []struct {
+		input      string
+		cursor     int
+		want       string
+		wantCursor int
+	}{
+		{input: "abcd", cursor: 2, want: "acbd", wantCursor: 3},
+		{input: "abcd", cursor: 4, want: "abdc", wantCursor: 4},
+		{input: "日本語", cursor: 1, want: "本日語", wantCursor: 2},
+		{input: "a🇯🇵", cursor: 3, want: "🇯🇵a", wantCursor: 3},
+		{input: "e\u0301x", cursor: 2, want: "xe\u0301", wantCursor: 3},
+	}
+
+	for _, tt := range tests {
+		b := newBuffer(tt.input)
+		cursor, ok := b.transposeChars(tt.cursor)
+		if !ok || b.String() != tt.want || cursor != tt.wantCursor {
+			t.Fatalf("transposeChars(%q, %d) = %q, %d, %v, want %q, %d", tt.input, tt.cursor, b.String(), cursor, ok, tt.want, tt.wantCursor)
+		}
+	}
+	b := newBuffer("ab")
+	if _, ok := b.transposeChars(0); ok {
+		t.Fatal("transposeChars at start of line returned ok")
+	}
+}
+
+func TestBufferUndoEdits(t *testing.T) {
+	b := newBuffer("hello world")
+	b.insert(5, ',')
+	b.setRune(0, 'H')
+	b.replace(7, 12, []rune("there")...)
+	b.delete(0, 0)
+	b.set([]rune("Hello, there"))
+	edits := b.takeEdits()
+	if len(edits) != 3 || !b.changedBy(edits) {
+		t.Fatalf("edits = %+v, want 3 that change the text", edits)
+	}
+	for i := len(edits) - 1; i >= 0; i-- {
+		b.undo(edits[i])
+	}
+	if b.String() != "hello world" {
+		t.Fatalf("undo = %q, want %q", b.String(), "hello world")
+	}
+	for _, ed := range edits {
+		b.redo(ed)
+	}
+	if b.String() != "Hello, there" {
+		t.Fatalf("redo = %q, want %q", b.String(), "Hello, there")
+	}
+
+	b.takeEdits()
+	b.insert(0, 'x')
+	b.delete(0, 1)
+	if b.changedBy(b.takeEdits()) {
+		t.Fatal("changedBy reported a change for edits that cancel out")
+	}
+}
+
+func BenchmarkBufferInsertMiddle(b *testing.B) {
+	text := []rune(strings.Repeat("SELECT * FROM t WHERE x = 1;\n", 2000))
+	for i := 0; i < b.N; i++ {
+		buf := newBuffer(string(text))
+		pos := len(text) / 2
+		for j := 0; j < 1000; j++ {
+			buf.insert(pos, 'x')
+			pos++
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package rl
+
+import (
+	"strings"
+	"unicode"
+)
+
+// commands holds the named editing commands that can be bound to keys. The
+// names follow GNU readline where an equivalent command exists.
+var commands map[string]func(*Editor)
+
+func init() {
+	commands = map[string]func(*Editor){
+		"beginning-of-line":       beginningOfLine,
+		"end-of-line":             endOfLine,
+		"backward-char":           backwardChar,
+		"forward-char":            forwardChar,
+		"backward-word":           backwardWordCmd,
+		"forward-word":            forwardWordCmd,
+		"accept-line":             acceptLine,
+		"accept-and-hold":         acceptAndHold,
+		"interrupt":               interrupt,
+		"end-of-file":             endOfFile,
+		"delete-char":             deleteChar,
+		"backward-delete-char":    backwardDeleteChar,
+		"self-insert":             selfInsert,
+		"quoted-insert":           quotedInsert,
+		"bracketed-paste-begin":   bracketedPasteBegin,
+		"complete":                complete,
+		"clear-screen":            clearScreen,
+		"previous-history":        previousHistory,
+		"next-history":            nextHistory,
+		"history-search-backward": historySearchBackward,
+		"history-search-forward":  historySearchForward,
+		"reverse-search-history":  reverseSearchHistory,
+		"forward-search-history":  forwardSearchHistory,
+		"kill-line":               killLine,
+		"unix-line-discard":       unixLineDiscard,
+		"unix-word-rubout":        unixWordRubout,
+		"kill-word":               killWord,
+		"backward-kill-word":      backwardKillWord,
+		"yank":                    (*Editor).yank,
+		"yank-pop":                (*Editor).yankPop,
+		"undo":                    (*Editor).undoEdit,
+		"redo":                    (*Editor).redoEdit,
+		"revert-line":             (*Editor).revertLine,
+		"transpose-chars":         transposeCharsCmd,
+		"transpose-words":         transposeWordsCmd,
+		"upcase-word":             upcaseWord,
+		"downcase-word":           downcaseWord,
+		"capitalize-word":         capitalizeWord,
+		"re-read-init-file":       reReadInitFile,
+		"digit-argument":          digitArgument,
+		"universal-argument":      universalArgument,
+		"start-kbd-macro":         startKbdMacro,
+		"end-kbd-macro":           endKbdMacro,
+		"call-last-kbd-macro":     callLastKbdMacro,
+		"vi-movement-mode":        viMovementMode,
+		"vi-insertion-mode":       viInsertionMode,
+		"vi-append-mode":          viAppendMode,
+		"vi-insert-beg":           viInsertBeg,
+		"vi-append-eol":           viAppendEOL,
+		"vi-arg-digit":            viArgDigit,
+		"vi-next-word":            viMotionCmd,
+		"vi-prev-word":            viMotionCmd,
+		"vi-end-word":             viMotionCmd,
+		"vi-first-print":          viMotionCmd,
+		"vi-char-search":          viMotionCmd,
+		"vi-delete":               viDelete,
+		"vi-rubout":               viRubout,
+		"vi-subst":                viSubst,
+		"vi-change-char":          viChangeChar,
+		"vi-change-case":          viChangeCase,
+		"vi-delete-to":            viDeleteTo,
+		"vi-change-to":            viChangeTo,
+		"vi-yank-to":              viYankTo,
+		"vi-put":                  viPut,
+		"vi-redo":                 viRedo,
+		"vi-search":               viSearch,
+		"vi-search-again":         viSearchAgain,
+	}
+}
+
+func beginningOfLine(e *Editor) {
+	e.c.cursor_x = 0
+}
+
+func endOfLine(e *Editor) {
+	e.c.cursor_x = e.c.input.len()
+}
+
+func backwardChar(e *Editor) {
+	e.c.cursor_x = moveGraphemes(&e.c.input, e.c.cursor_x, -e.count())
+}
+
+func forwardChar(e *Editor) {
+	e.c.cursor_x = moveGraphemes(&e.c.input, e.c.cursor_x, e.count())
+}
+
+// wordPos returns the position n words after the cursor, or -n words
+// before it when n is negative.
+func (e *Editor) wordPos(n int) int {
+	pos := e.c.cursor_x
+	for ; n > 0; n-- {
+		pos = forwardWord(e.c.input.runes(), pos, e.r.WordChars)
+	}
+	for ; n < 0; n++ {
+		pos = backwardWord(e.c.input.runes(), pos, e.r.WordChars)
+	}
+	return pos
+}
+
+func backwardWordCmd(e *Editor) {
+	e.c.cursor_x = e.wordPos(-e.count())
+}
+
+func forwardWordCmd(e *Editor) {
+	e.c.cursor_x = e.wordPos(e.count())
+}
+
+func acceptLine(e *Editor) {
+	e.state = stateAccepted
+}
+
+// acceptAndHold accepts the line and starts the next one with the same
+// text.
+func acceptAndHold(e *Editor) {
+	e.state = stateAccepted
+	if !e.password {
+		e.r.heldLine = e.c.input.String()
+	}
+}
+
+func interrupt(e *Editor) {
+	e.state = stateInterrupted
+}
+
+// endOfFile ends input on an empty line. With a numeric argument it
+// deletes characters instead, like delete-char.
+func endOfFile(e *Editor) {
+	if e.arg != 0 {
+		deleteChar(e)
+		return
+	}
+	if shouldReturnEOFOnCtrlD(e.c.input.runes(), e.r.EOFOnCtrlD) {
+		e.state = stateEOF
+	}
+}
+
+// deleteChar deletes the character under the cursor. With a numeric
+// argument the characters are killed, as in readline.
+func deleteChar(e *Editor) {
+	if n := e.count(); n != 1 {
+		e.killChars(n)
+		return
+	}
+	if e.c.cursor_x < e.c.input.len() {
+		e.c.input.delete(e.c.cursor_x, nextGrapheme(&e.c.input, e.c.cursor_x))
+		e.dirty = true
+	}
+}
+
+func backwardDeleteChar(e *Editor) {
+	if n := e.count(); n != 1 {
+		e.killChars(-n)
+		return
+	}
+	var ok bool
+	e.c.cursor_x, ok = e.c.input.deleteBefore(e.c.cursor_x)
+	if ok {
+		e.dirty = true
+	}
+}
+
+// killChars kills n characters after the cursor, or -n before it.
+func (e *Editor) killChars(n int) {
+	if pos := moveGraphemes(&e.c.input, e.c.cursor_x, n); n < 0 {
+		e.kill(pos, e.c.cursor_x, true)
+	} else {
+		e.kill(e.c.cursor_x, pos, false)
+	}
+}
+
+func selfInsert(e *Editor) {
+	if e.key.Code != KeyRune {
+		return
+	}
+	var rs []rune
+	for n := e.count(); n > 0; n-- {
+		rs = append(rs, e.key.Rune)
+	}
+	// Characters already waiting, as when text is pasted without bracketed
+	// paste, are inserted together, up to the start of the next word so
+	// that undo still removes one word at a time.
+	if m := e.keymap(); e.arg == 0 && !m.noInsert {
+		for len(e.keys) > 0 && isSelfInsert(e.keys[0]) && m.bindings[e.keys[0]] == nil {
+			if unicode.IsSpace(rs[len(rs)-1]) && !unicode.IsSpace(e.keys[0].Rune) {
+				break
+			}
+			rs = append(rs, e.takeKey().Rune)
+		}
+	}
+	e.c.input.insert(e.c.cursor_x, rs...)
+	e.c.cursor_x += len(rs)
+	e.dirty = true
+	e.thisCmd = cmdInsert
+}
+
+// quotedInsert inserts the next key typed as a character, even when it is
+// bound to a command like Tab or Ctrl-C.
+func quotedInsert(e *Editor) {
+	k, ok := e.nextKey()
+	if !ok {
+		return
+	}
+	rs := keyRunes(k)
+	if rs == nil {
+		return
+	}
+	for n := e.count(); n > 0; n-- {
+		e.c.input.insert(e.c.cursor_x, rs...)
+		e.c.cursor_x += len(rs)
+	}
+	e.dirty = true
+}
+
+// bracketedPasteBegin inserts the text of a bracketed paste as it is, so
+// that pasted tabs and newlines neither complete nor accept the line.
+func bracketedPasteBegin(e *Editor) {
+	var text []rune
+	for {
+		k, ok := e.nextKey()
+		if !ok {
+			return
+		}
+		if k.Code == KeyPasteEnd {
+			break
+		}
+		text = append(text, keyRunes(k)...)
+	}
+
+	s := strings.ReplaceAll(string(text), "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	if e.r.PasteNewline != "" {
+		s = strings.ReplaceAll(s, "\n", e.r.PasteNewline)
+	}
+	e.Insert(s)
+}
+
+func complete(e *Editor) {
+	if e.r.CompleteFunc == nil {
+		return
+	}
+	completePos, candidates := e.r.CompleteFunc(e.c.input.String(), e.c.cursor_x)
+	var ok bool
+	e.c.cursor_x, ok = e.c.input.complete(completePos, e.c.cursor_x, candidates, e.r.CompletionIgnoreCase)
+	if ok {
+		e.dirty = true
+	}
+}
+
+func clearScreen(e *Editor) {
+	e.c.clear = true
+	e.dirty = true
+}
+
+func previousHistory(e *Editor) {
+	e.historyStep(-e.count())
+}
+
+func nextHistory(e *Editor) {
+	e.historyStep(e.count())
+}
+
+// historyStep moves n entries through the history, one at a time so that
+// a large count stops at the first or last entry.
+func (e *Editor) historyStep(n int) {
+	step := 1
+	if n < 0 {
+		n, step = -n, -1
+	}
+	for ; n > 0; n-- {
+		if e.r.HistorySearchPrefix {
+			e.historySearch(step)
+		} else {
+			e.historyMove(step)
+		}
+	}
+}
+
+func historySearchBackward(e *Editor) {
+	e.historySearch(-1)
+}
+
+func historySearchForward(e *Editor) {
+	e.historySearch(1)
+}
+
+func reverseSearchHistory(e *Editor) {
+	if err := e.isearch(true); err != nil {
+		e.readErr = err
+	}
+}
+
+func forwardSearchHistory(e *Editor) {
+	if err := e.isearch(false); err != nil {
+		e.readErr = err
+	}
+}
+
+func killLine(e *Editor) {
+	e.kill(e.c.cursor_x, e.c.input.len(), false)
+}
+
+func unixLineDiscard(e *Editor) {
+	e.kill(0, e.c.cursor_x, true)
+}
+
+func unixWordRubout(e *Editor) {
+	e.kill(e.c.input.wordStart(e.c.cursor_x), e.c.cursor_x, true)
+}
+
+func killWord(e *Editor) {
+	e.killWords(e.count())
+}
+
+func backwardKillWord(e *Editor) {
+	e.killWords(-e.count())
+}
+
+// killWords kills n words after the cursor, or -n before it.
+func (e *Editor) killWords(n int) {
+	if pos := e.wordPos(n); n < 0 {
+		e.kill(pos, e.c.cursor_x, true)
+	} else {
+		e.kill(e.c.cursor_x, pos, false)
+	}
+}
+
+func transposeCharsCmd(e *Editor) {
+	var ok bool
+	e.c.cursor_x, ok = e.c.input.transposeChars(e.c.cursor_x)
+	if ok {
+		e.dirty = true
+	}
+}
+
+func transposeWordsCmd(e *Editor) {
+	if start, words, ok := transposeWords(e.c.input.runes(), e.c.cursor_x, e.r.WordChars); ok {
+		e.c.input.replace(start, start+len(words), words...)
+		e.c.cursor_x = start + len(words)
+		e.dirty = true
+	}
+}
+
+func (e *Editor) changeWordCase(conv func(r rune, first bool) rune) {
+	word := changeWordCase(e.c.input.runes(), e.c.cursor_x, e.r.WordChars, conv)
+	e.c.input.replace(e.c.cursor_x, e.c.cursor_x+len(word), word...)
+	e.c.cursor_x += len(word)
+	e.dirty = true
+}
+
+func upcaseWord(e *Editor) {
+	e.changeWordCase(upcaseRune)
+}
+
+func downcaseWord(e *Editor) {
+	e.changeWordCase(downcaseRune)
+}
+
+func capitalizeWord(e *Editor) {
+	e.changeWordCase(capitalizeRune)
+}
@@ -0,0 +1,386 @@
+package rl
+
+import "time"
+
+type cmdKind int
+
+const (
+	cmdOther cmdKind = iota
+	cmdInsert
+	cmdKill
+	cmdYank
+	cmdUndo
+	cmdLoad
+)
+
+type editState int
+
+const (
+	stateEditing editState = iota
+	stateAccepted
+	stateInterrupted
+	stateEOF
+)
+
+// Editor is the line being edited. Functions bound with Keymap.BindFunc
+// receive it to inspect and change the line.
+type Editor struct {
+	r            *Rl
+	c            *ctx
+	password     bool
+	passwordRune rune
+	dirty        bool
+	keys         []Key
+	state        editState
+	readErr      error
+
+	// prompt is the prompt set for the line, shown after the mode string.
+	prompt string
+	shape  cursorShape
+
+	// key is the key that invoked the running command and seqLen the
+	// length of the key sequence bound to it.
+	key    Key
+	seqLen int
+
+	// histIdx is the history entry being edited; len(r.history) is the
+	// new line, whose contents are kept in scratch while browsing.
+	histIdx int
+	scratch []rune
+
+	// lastCmd and thisCmd classify the previous and current command so
+	// that kills can be merged and yanks replaced.
+	lastCmd   cmdKind
+	thisCmd   cmdKind
+	yankStart int
+	yankIdx   int
+
+	undo       []change
+	redo       []change
+	origin     snapshot
+	lastInsert rune
+
+	// arg is the numeric argument typed before a command. A command that
+	// sets keepArg passes it on to the next one.
+	arg     int
+	keepArg bool
+
+	// viCommand is set while vi mode is in command mode.
+	viCommand bool
+	// viKeys collects the keys of the vi change being typed and
+	// viLastChange the keys of the last complete one, replayed by ".".
+	viKeys       []Key
+	viLastChange []Key
+	viInChange   bool
+	// viUndoMark is the length of the undo history when the vi change
+	// being typed started. Its edits are undone as one.
+	viUndoMark int
+	// viSearchKind and viSearchRune are the last f, F, t or T search,
+	// repeated by ; and ,.
+	viSearchKind     byte
+	viSearchRune     rune
+	viSearchBackward bool
+}
+
+// readKey returns the next key press, redrawing the line before blocking
+// for more input. The redraw is skipped while more input is already
+// waiting, so a paste is drawn once when it has all been handled.
+func (e *Editor) readKey() (Key, error) {
+	for len(e.keys) == 0 {
+		if !e.c.inputReady() {
+			if e.c.refresh {
+				e.c.refresh = false
+				e.dirty = true
+			}
+			e.updatePrompts()
+			if err := e.c.redraw(e.dirty, e.passwordRune); err != nil {
+				return Key{}, err
+			}
+			e.dirty = false
+		}
+
+		ks, err := e.c.readKeys()
+		if err != nil {
+			return Key{}, err
+		}
+		if e.r.recording {
+			e.r.macroRec = append(e.r.macroRec, ks...)
+		}
+		e.keys = ks
+	}
+
+	return e.takeKey(), nil
+}
+
+// takeKey removes the first key from e.keys.
+func (e *Editor) takeKey() Key {
+	k := e.keys[0]
+	e.keys = e.keys[1:]
+	if e.viCommand || e.viInChange {
+		e.viKeys = append(e.viKeys, k)
+	}
+	return k
+}
+
+// nextKey reads a key for a command that needs more input. A read error
+// ends editing.
+func (e *Editor) nextKey() (Key, bool) {
+	k, err := e.readKey()
+	if err != nil {
+		e.readErr = err
+		return Key{}, false
+	}
+	return k, true
+}
+
+// keymap returns the keymap for the current editing mode.
+func (e *Editor) keymap() *Keymap {
+	if e.r.Mode != ModeVi {
+		return e.r.Keymap
+	}
+	if e.viCommand {
+		return e.r.ViCommandKeymap
+	}
+	return e.r.ViInsertKeymap
+}
+
+// handleKey runs the command for k and records what it did for undo.
+func (e *Editor) handleKey(k Key) {
+	e.lastCmd, e.thisCmd = e.thisCmd, cmdOther
+	wasCommand := e.viCommand
+	if wasCommand && !e.viInChange && e.arg == 0 {
+		e.viKeys = []Key{k}
+	}
+	if wasCommand && !e.viInChange {
+		e.viUndoMark = len(e.undo)
+	}
+	e.c.input.takeEdits()
+	before := e.c.cursor_x
+
+	e.keepArg = false
+	e.dispatch(e.keymap(), k)
+	if e.readErr != nil {
+		return
+	}
+	if !e.keepArg {
+		e.arg = 0
+	}
+	edits := e.c.input.takeEdits()
+	if !e.c.input.changedBy(edits) {
+		edits = nil
+	}
+	e.recordUndo(edits, before, k)
+	if e.r.Mode == ModeVi {
+		e.viFinish(len(edits) > 0, wasCommand)
+	}
+	e.updateMode()
+}
+
+// updatePrompts calls PromptFunc and RightPromptFunc before a redraw.
+func (e *Editor) updatePrompts() {
+	if e.r.PromptFunc != nil {
+		if p := e.r.PromptFunc(); p != e.prompt {
+			// A search or argument prompt shown in place of the prompt
+			// stays until its command ends, after which updateMode shows
+			// the new prompt.
+			_, last := splitPromptHead(e.prompt)
+			shown := e.c.prompt == e.modeString()+last
+			e.prompt = p
+			if shown {
+				e.updateMode()
+			}
+		}
+	}
+	if rp := e.rightPrompt(); rp != e.c.rprompt {
+		e.c.rprompt = rp
+		e.dirty = true
+	}
+}
+
+// rightPrompt returns the right prompt to show now.
+func (e *Editor) rightPrompt() string {
+	if e.r.RightPromptFunc != nil {
+		return e.r.RightPromptFunc()
+	}
+	return e.r.RightPrompt
+}
+
+// modeString returns the indicator of the editing mode shown before the
+// prompt.
+func (e *Editor) modeString() string {
+	switch {
+	case !e.r.ShowModeInPrompt:
+		return ""
+	case e.r.Mode != ModeVi:
+		return e.r.EmacsModeString
+	case e.viCommand:
+		return e.r.ViCmdModeString
+	}
+	return e.r.ViInsModeString
+}
+
+// updateMode shows the current editing mode in the prompt and the cursor
+// shape.
+func (e *Editor) updateMode() {
+	head, prompt := splitPromptHead(e.prompt)
+	if prompt = e.modeString() + prompt; prompt != e.c.prompt {
+		e.c.prompt = prompt
+		e.dirty = true
+	}
+	if head != e.c.head {
+		e.c.head = head
+		e.c.head_drawn = false
+		e.dirty = true
+	}
+
+	shape := cursorDefault
+	if e.r.Mode == ModeVi && e.r.ViCursorShape {
+		shape = cursorBar
+		if e.viCommand {
+			shape = cursorBlock
+		}
+	}
+	if shape != e.shape {
+		e.c.setCursorShape(shape)
+		e.shape = shape
+	}
+}
+
+// dispatch runs the command bound to the key sequence starting with k,
+// reading further keys while the sequence is a prefix of longer bindings.
+// Unbound character keys are inserted unless m is a vi command keymap.
+func (e *Editor) dispatch(m *Keymap, k Key) {
+	b := m.bindings[k]
+	if b == nil && k.Alt && m == e.r.ViInsertKeymap {
+		// Escape and a key typed right after it are read as one Alt key.
+		// Unless that is bound, it is Escape, leaving insert mode, and
+		// then the key, as in readline.
+		k.Alt = false
+		e.keys = append([]Key{k}, e.keys...)
+		k = Key{Code: KeyEscape}
+		if n := len(e.viKeys); n > 0 && e.viInChange {
+			e.viKeys[n-1] = k
+		}
+		b = m.bindings[k]
+	}
+	seqLen := 1
+	if b == nil && k == (Key{Code: KeyEscape}) && m == e.r.Keymap {
+		// Without a Meta key, Escape typed before a key gives it Alt,
+		// as in readline, however long the pause between them.
+		next, ok := e.nextKey()
+		if !ok {
+			return
+		}
+		next.Alt = true
+		k, b = next, m.bindings[next]
+		seqLen++
+	}
+	var read []Key
+	for b != nil && b.next != nil {
+		if isSelfInsert(k) && !m.noInsert && !e.waitKeyseq() {
+			b = nil
+			break
+		}
+		next, ok := e.nextKey()
+		if !ok {
+			return
+		}
+		read = append(read, next)
+		b = b.next.bindings[next]
+	}
+
+	e.key = k
+	e.seqLen = seqLen + len(read)
+	if b == nil {
+		if isSelfInsert(k) && !m.noInsert {
+			// A character starting a longer binding, like j in "jk",
+			// is typed as usual when the rest does not follow.
+			if len(read) > 0 {
+				e.keys = append(read, e.keys...)
+			}
+			selfInsert(e)
+		}
+		return
+	}
+	b.fn(e)
+}
+
+// waitKeyseq waits up to KeyseqTimeout for the next key of a sequence and
+// reports whether it came. Keys already read, such as the rest of a paste
+// or macro, have come.
+func (e *Editor) waitKeyseq() bool {
+	if len(e.keys) > 0 || e.r.KeyseqTimeout <= 0 {
+		return true
+	}
+	ready, err := e.c.waitInput(int(e.r.KeyseqTimeout / time.Millisecond))
+	// A failed wait leaves the error to the read that follows.
+	return ready || err != nil
+}
+
+// Key returns the key that ran the current command. For a command bound to
+// a sequence of keys it is the first.
+func (e *Editor) Key() Key {
+	return e.key
+}
+
+// Line returns the text being edited.
+func (e *Editor) Line() string {
+	return e.c.input.String()
+}
+
+// SetLine replaces the text being edited and moves the cursor to its end.
+func (e *Editor) SetLine(line string) {
+	e.c.input.set([]rune(line))
+	e.c.cursor_x = e.c.input.len()
+	e.dirty = true
+}
+
+// Cursor returns the cursor position in runes.
+func (e *Editor) Cursor() int {
+	return e.c.cursor_x
+}
+
+// SetCursor moves the cursor to pos runes from the start of the line.
+func (e *Editor) SetCursor(pos int) {
+	if pos < 0 {
+		pos = 0
+	}
+	if pos > e.c.input.len() {
+		pos = e.c.input.len()
+	}
+	e.c.cursor_x = pos
+}
+
+// Insert inserts s at the cursor.
+func (e *Editor) Insert(s string) {
+	rs := []rune(s)
+	e.c.input.insert(e.c.cursor_x, rs...)
+	e.c.cursor_x += len(rs)
+	e.dirty = true
+}
+
+// Prompt returns the prompt shown for the line, without the mode string.
+func (e *Editor) Prompt() string {
+	return e.prompt
+}
+
+// SetPrompt changes the prompt shown for the rest of this line.
+func (e *Editor) SetPrompt(prompt string) {
+	e.prompt = prompt
+	e.updateMode()
+}
+
+// Accept finishes editing, making ReadLine return the current line.
+func (e *Editor) Accept() {
+	e.state = stateAccepted
+}
+
+// Run runs the named editing command, such as "kill-line".
+func (e *Editor) Run(name string) error {
+	fn, ok := commands[name]
+	if !ok {
+		return &UnknownCommandError{Name: name}
+	}
+	fn(e)
+	return nil
+}
@@ -3,8 +3,7 @@ module github.com/mattn/go-rl
 go 1.25.6
 
 require (
+	github.com/clipperhouse/uax29/v2 v2.2.0
 	github.com/mattn/go-runewidth v0.0.20
 	golang.org/x/sys v0.46.0
 )
-
-require github.com/clipperhouse/uax29/v2 v2.2.0 // indirect
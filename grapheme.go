@@ -0,0 +1,134 @@
+package rl
+
+import (
+	"unicode/utf8"
+
+	"github.com/clipperhouse/uax29/v2/graphemes"
+	"github.com/mattn/go-runewidth"
+)
+
+// Cursor positions count runes, but the cursor only stops between extended
+// grapheme clusters, so that a flag, an emoji joined with ZWJ or a letter
+// with combining marks moves and deletes as one character.
+
+// text is what the grapheme helpers read: the line buffer, which they read
+// around the cursor without moving its gap, or a runeSlice.
+type text interface {
+	len() int
+	at(i int) rune
+	slice(start, end int) []rune
+}
+
+// runeSlice lets the grapheme helpers read a []rune.
+type runeSlice []rune
+
+func (rs runeSlice) len() int                    { return len(rs) }
+func (rs runeSlice) at(i int) rune               { return rs[i] }
+func (rs runeSlice) slice(start, end int) []rune { return rs[start:end] }
+
+// nextGrapheme returns the end of the grapheme cluster starting at pos.
+func nextGrapheme(t text, pos int) int {
+	if pos >= t.len() {
+		return t.len()
+	}
+	// Segment a window after pos, widening it until the first cluster
+	// ends before the window does and is known to be complete.
+	for size := 16; ; size *= 2 {
+		end := min(pos+size, t.len())
+		g := graphemes.FromString(string(t.slice(pos, end)))
+		g.Next()
+		n := utf8.RuneCountInString(g.Value())
+		if pos+n < end || end == t.len() {
+			return pos + n
+		}
+	}
+}
+
+// prevGrapheme returns the start of the grapheme cluster ending at pos.
+func prevGrapheme(t text, pos int) int {
+	if pos <= 0 {
+		return 0
+	}
+	start := pos - 1
+	for start > 0 && !asciiBoundary(t, start) {
+		start--
+	}
+	last := start
+	g := graphemes.FromString(string(t.slice(start, pos)))
+	for g.Next() {
+		if n := utf8.RuneCountInString(g.Value()); start+n < pos {
+			start += n
+			last = start
+		}
+	}
+	return last
+}
+
+// asciiBoundary reports whether a cluster certainly starts at pos because
+// it lies between two ASCII characters, which never join except for CR LF.
+// Scanning back to such a point lets prevGrapheme avoid segmenting the
+// whole line.
+func asciiBoundary(t text, pos int) bool {
+	a, b := t.at(pos-1), t.at(pos)
+	return a < utf8.RuneSelf && b < utf8.RuneSelf && !(a == '\r' && b == '\n')
+}
+
+// moveGraphemes returns the position n clusters after pos, or -n before
+// it when n is negative, stopping at either end of t.
+func moveGraphemes(t text, pos, n int) int {
+	for ; n > 0 && pos < t.len(); n-- {
+		pos = nextGrapheme(t, pos)
+	}
+	for ; n < 0 && pos > 0; n++ {
+		pos = prevGrapheme(t, pos)
+	}
+	return pos
+}
+
+// cell is a piece of the prompt or line as drawn on the terminal.
+type cell struct {
+	s     string
+	width int
+	// pos and n give the runes of the line that the cell shows. pos is
+	// -1 for cells of the prompt.
+	pos int
+	n   int
+	// hidden marks an invisible span of the prompt, such as a color
+	// escape sequence.
+	hidden bool
+}
+
+// lineCells splits the prompt and the line into the cells to draw: one for
+// each grapheme cluster, one in caret notation for each control character
+// of the line, and a hidden one for each invisible span of the prompt.
+func lineCells(prompt string, input []rune) []cell {
+	var cells []cell
+	for _, part := range splitPrompt(prompt) {
+		if part.hidden {
+			cells = append(cells, cell{s: part.s, pos: -1, hidden: true})
+			continue
+		}
+		g := graphemes.FromString(part.s)
+		for g.Next() {
+			cells = append(cells, cell{s: g.Value(), width: runewidth.StringWidth(g.Value()), pos: -1})
+		}
+	}
+
+	pos := 0
+	g := graphemes.FromString(string(input))
+	for g.Next() {
+		s := g.Value()
+		n := utf8.RuneCountInString(s)
+		if r, _ := utf8.DecodeRuneInString(s); r < 0x20 || r == 0x7f {
+			for _, r := range s {
+				d := displayRune(r)
+				cells = append(cells, cell{s: d, width: runewidth.StringWidth(d), pos: pos, n: 1})
+				pos++
+			}
+			continue
+		}
+		cells = append(cells, cell{s: s, width: runewidth.StringWidth(s), pos: pos, n: n})
+		pos += n
+	}
+	return cells
+}
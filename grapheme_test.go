@@ -0,0 +1,109 @@
+package rl
+
+import (
+	"reflect"
+	"testing"
+)
+
+const (
+	flag   = "🇯🇵"
+	family = "👨‍👩‍👧"
+	acute  = "e\u0301"
+)
+
+func TestGraphemeBoundaries(t *testing.T) {
+	rs := runeSlice("a" + flag + flag + family + acute + "\r\nb")
+	var next, prev []int
+	for pos := 0; pos < len(rs); pos = nextGrapheme(rs, pos) {
+		next = append(next, pos)
+	}
+	for pos := len(rs); pos > 0; {
+		pos = prevGrapheme(rs, pos)
+		prev = append([]int{pos}, prev...)
+	}
+	want := []int{0, 1, 3, 5, 10, 12, 14}
+	if !reflect.DeepEqual(next, want) {
+		t.Errorf("nextGrapheme stops at %v, want %v", next, want)
+	}
+	if !reflect.DeepEqual(prev, want) {
+		t.Errorf("prevGrapheme stops at %v, want %v", prev, want)
+	}
+	if got := moveGraphemes(rs, 1, 3); got != 10 {
+		t.Errorf("moveGraphemes(1, 3) = %d, want 10", got)
+	}
+	if got := moveGraphemes(rs, 10, -10); got != 0 {
+		t.Errorf("moveGraphemes(10, -10) = %d, want 0", got)
+	}
+}
+
+func TestNextGraphemeLongCluster(t *testing.T) {
+	rs := runeSlice("a")
+	for i := 0; i < 40; i++ {
+		rs = append(rs, 0x301)
+	}
+	rs = append(rs, 'b')
+	if got := nextGrapheme(rs, 0); got != 41 {
+		t.Fatalf("nextGrapheme = %d, want 41", got)
+	}
+	if got := prevGrapheme(rs, 41); got != 0 {
+		t.Fatalf("prevGrapheme = %d, want 0", got)
+	}
+}
+
+func TestGraphemeEditing(t *testing.T) {
+	const cafe = "caf" + acute + " bar"
+	vi := func(keys string) []Key { return append([]Key{viEsc}, typeKeys(keys)...) }
+	tests := []struct {
+		name       string
+		input      string
+		cursor     int
+		keys       []Key
+		want       string
+		cursorWant int
+		vi         bool
+	}{
+		{"backspace flag", "a" + flag, 3, []Key{{Code: KeyBackspace}}, "a", 1, false},
+		{"backspace family", family + "x", 5, []Key{{Code: KeyBackspace}}, "x", 0, false},
+		{"backspace combining", "x" + acute, 3, []Key{{Code: KeyBackspace}}, "x", 1, false},
+		{"delete family", family + "x", 0, []Key{{Code: KeyDelete}}, "x", 0, false},
+		{"forward", family + acute + "x", 0, []Key{ctrlKey('f'), ctrlKey('f')}, family + acute + "x", 7, false},
+		{"backward", flag + acute, 4, []Key{ctrlKey('b')}, flag + acute, 2, false},
+		{"kill with count", flag + flag + "x", 0, []Key{altKey('2'), {Code: KeyDelete}}, "x", 0, false},
+		{"forward word", cafe, 0, []Key{altKey('f')}, cafe, 5, false},
+		{"backward word", cafe, 5, []Key{altKey('b')}, cafe, 0, false},
+		{"kill word", cafe, 0, []Key{altKey('d')}, " bar", 0, false},
+		{"upcase word", cafe, 0, []Key{altKey('u')}, "CAFE\u0301 bar", 5, false},
+		{"transpose words", cafe, 9, []Key{altKey('t')}, "bar " + "caf" + acute, 9, false},
+		{"vi dw", cafe, 9, vi("0dw"), "bar", 0, true},
+		{"vi de", cafe, 9, vi("0de"), " bar", 0, true},
+		{"vi e", cafe, 9, vi("0e"), cafe, 3, true},
+		{"vi b", cafe, 9, vi("bb"), cafe, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Editor{r: NewRl(), c: &ctx{input: newBuffer(tt.input), cursor_x: tt.cursor}}
+			if tt.vi {
+				e.r.Mode = ModeVi
+			}
+			runKeys(e, tt.keys...)
+			if got := e.c.input.String(); got != tt.want || e.c.cursor_x != tt.cursorWant {
+				t.Fatalf("got %q cursor %d, want %q cursor %d", got, e.c.cursor_x, tt.want, tt.cursorWant)
+			}
+		})
+	}
+}
+
+func TestLineCells(t *testing.T) {
+	got := lineCells("> ", []rune(family+"\t"+acute))
+	want := []cell{
+		{s: ">", width: 1, pos: -1},
+		{s: " ", width: 1, pos: -1},
+		{s: family, width: 2, pos: 0, n: 5},
+		{s: "^I", width: 2, pos: 5, n: 1},
+		{s: acute, width: 1, pos: 6, n: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("lineCells = %+v, want %+v", got, want)
+	}
+}
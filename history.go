@@ -0,0 +1,280 @@
+package rl
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// AddHistory appends line to the history. Empty lines and lines equal to
+// the most recent entry are not recorded. When HistoryFile is set the line
+// is also appended to the file; errors writing it are ignored, use
+// SaveHistory to detect them.
+func (r *Rl) AddHistory(line string) {
+	r.loadHistoryFile()
+	h := appendHistory(r.history, line)
+	if len(h) == len(r.history) {
+		return
+	}
+	r.history = trimHistory(h, r.HistorySize)
+	if r.HistoryFile != "" {
+		appendHistoryFile(r.HistoryFile, line, r.HistorySize)
+	}
+}
+
+// History returns a copy of the history, oldest entry first.
+func (r *Rl) History() []string {
+	return append([]string(nil), r.history...)
+}
+
+// ClearHistory removes all history entries.
+func (r *Rl) ClearHistory() {
+	r.history = nil
+}
+
+// LoadHistory replaces the history with the entries stored in the file at
+// path, keeping at most HistorySize of the newest ones.
+func (r *Rl) LoadHistory(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := lockFile(f, false); err != nil {
+		return err
+	}
+	defer unlockFile(f)
+
+	h, err := readHistory(f)
+	if err != nil {
+		return err
+	}
+	r.history = trimHistory(h, r.HistorySize)
+	return nil
+}
+
+// SaveHistory writes the history to the file at path, replacing its
+// contents.
+func (r *Rl) SaveHistory(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := lockFile(f, true); err != nil {
+		return err
+	}
+	defer unlockFile(f)
+
+	return rewriteHistory(f, trimHistory(r.history, r.HistorySize))
+}
+
+func (r *Rl) loadHistoryFile() error {
+	if r.HistoryFile == "" || r.historyLoaded {
+		return nil
+	}
+	// The file is only tried once: an unreadable history file is reported
+	// to the first ReadLine but does not stop the ones after it.
+	r.historyLoaded = true
+	err := r.LoadHistory(r.HistoryFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// appendHistoryFile adds line to the history file at path while holding an
+// exclusive lock on it, so concurrent sessions sharing the file do not
+// overwrite each other. The file is rewritten with the newest max entries
+// when it grows past twice that many, so that most appends only count its
+// lines.
+func appendHistoryFile(path, line string, max int) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := lockFile(f, true); err != nil {
+		return err
+	}
+	defer unlockFile(f)
+
+	if max > 0 {
+		n, err := countLines(f)
+		if err != nil {
+			return err
+		}
+		if n >= 2*max {
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			h, err := readHistory(f)
+			if err != nil {
+				return err
+			}
+			return rewriteHistory(f, trimHistory(append(h, line), max))
+		}
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	_, err = f.WriteString(encodeHistoryEntry(line) + "\n")
+	return err
+}
+
+// readHistory reads the entries of a history file. Lines have no length
+// limit, since a pasted line can be as long as it likes.
+func readHistory(r io.Reader) ([]string, error) {
+	var h []string
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line != "" {
+			h = append(h, decodeHistoryEntry(line))
+		}
+		if err == io.EOF {
+			return h, nil
+		}
+		if err != nil {
+			return h, err
+		}
+	}
+}
+
+// countLines counts the lines in r without decoding them.
+func countLines(r io.Reader) (int, error) {
+	var buf [32 * 1024]byte
+	n := 0
+	for {
+		m, err := r.Read(buf[:])
+		n += bytes.Count(buf[:m], []byte{'\n'})
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+func rewriteHistory(f *os.File, h []string) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, line := range h {
+		w.WriteString(encodeHistoryEntry(line))
+		w.WriteByte('\n')
+	}
+	return w.Flush()
+}
+
+// encodeHistoryEntry escapes backslashes and line breaks so that every
+// entry, including multi-line ones, occupies a single line in the file.
+func encodeHistoryEntry(line string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`).Replace(line)
+}
+
+func decodeHistoryEntry(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case '\\':
+			b.WriteByte('\\')
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+func appendHistory(h []string, line string) []string {
+	if line == "" || len(h) > 0 && h[len(h)-1] == line {
+		return h
+	}
+	return append(h, line)
+}
+
+// trimHistory drops the oldest entries of h so that at most max remain.
+func trimHistory(h []string, max int) []string {
+	if max > 0 && len(h) > max {
+		return append([]string(nil), h[len(h)-max:]...)
+	}
+	return h
+}
+
+// historyMove replaces the line with the history entry delta steps away
+// from the one being edited. Moving past the newest entry brings back the
+// line that was being typed before browsing started.
+func (e *Editor) historyMove(delta int) {
+	if e.password {
+		return
+	}
+	h := e.r.history
+	i := e.histIdx + delta
+	if i < 0 || i > len(h) || i == e.histIdx {
+		return
+	}
+	if e.histIdx == len(h) {
+		e.scratch = e.c.input.slice(0, e.c.input.len())
+	}
+	e.histIdx = i
+
+	if i == len(h) {
+		e.c.input.set(e.scratch)
+	} else {
+		e.c.input = newBuffer(h[i])
+	}
+	e.c.cursor_x = e.c.input.len()
+	e.dirty = true
+	e.resetUndo()
+}
+
+// historySearch moves delta steps through the history entries that start
+// with the text before the cursor, leaving the cursor where it is. With the
+// cursor at the start of the line it behaves like historyMove.
+func (e *Editor) historySearch(delta int) {
+	if e.c.cursor_x == 0 {
+		e.historyMove(delta)
+		return
+	}
+
+	prefix := string(e.c.input.slice(0, e.c.cursor_x))
+	line := e.c.input.String()
+	h := e.r.history
+	for i := e.histIdx + delta; i >= 0 && i <= len(h); i += delta {
+		if i < len(h) && (!strings.HasPrefix(h[i], prefix) || h[i] == line) {
+			continue
+		}
+		cursor := e.c.cursor_x
+		e.historyMove(i - e.histIdx)
+		if cursor < e.c.input.len() {
+			e.c.cursor_x = cursor
+		}
+		return
+	}
+}
@@ -0,0 +1,161 @@
+package rl
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAppendHistorySkipsEmptyAndDuplicates(t *testing.T) {
+	var h []string
+	for _, line := range []string{"ls", "", "ls", "pwd", "ls"} {
+		h = appendHistory(h, line)
+	}
+	want := []string{"ls", "pwd", "ls"}
+	if !reflect.DeepEqual(h, want) {
+		t.Fatalf("appendHistory = %q, want %q", h, want)
+	}
+}
+
+func TestHistoryMoveKeepsScratchLine(t *testing.T) {
+	r := NewRl()
+	r.AddHistory("first")
+	r.AddHistory("second")
+	e := &Editor{r: r, c: &ctx{input: newBuffer("draft"), cursor_x: 2}, histIdx: 2}
+
+	e.historyMove(-1)
+	e.historyMove(-1)
+	if e.c.input.String() != "first" || e.c.cursor_x != 5 {
+		t.Fatalf("after two Up: input %q cursor %d, want %q cursor 5", e.c.input.String(), e.c.cursor_x, "first")
+	}
+	e.historyMove(-1)
+	if e.c.input.String() != "first" {
+		t.Fatalf("Up past oldest entry: input %q, want %q", e.c.input.String(), "first")
+	}
+
+	e.historyMove(1)
+	e.historyMove(1)
+	if e.c.input.String() != "draft" {
+		t.Fatalf("Down back to new line: input %q, want %q", e.c.input.String(), "draft")
+	}
+	e.historyMove(1)
+	if e.histIdx != 2 {
+		t.Fatalf("Down past new line: histIdx %d, want 2", e.histIdx)
+	}
+}
+
+func TestHistoryEntryEncodingRoundTrips(t *testing.T) {
+	for _, line := range []string{"plain", "SELECT 1\nFROM t;", `C:\path\n`, "trailing\\"} {
+		enc := encodeHistoryEntry(line)
+		if got := decodeHistoryEntry(enc); got != line {
+			t.Fatalf("decodeHistoryEntry(%q) = %q, want %q", enc, got, line)
+		}
+	}
+}
+
+func TestSaveAndLoadHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	r := NewRl()
+	r.AddHistory("one")
+	r.AddHistory("two\nlines")
+	if err := r.SaveHistory(path); err != nil {
+		t.Fatal(err)
+	}
+
+	r2 := NewRl()
+	if err := r2.LoadHistory(path); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r2.History(), r.History()) {
+		t.Fatalf("LoadHistory = %q, want %q", r2.History(), r.History())
+	}
+}
+
+func TestHistoryFileIsTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	r := NewRl()
+	r.HistoryFile = path
+	r.HistorySize = 2
+	for _, line := range []string{"a", "b", "c", "d"} {
+		r.AddHistory(line)
+	}
+	want := []string{"c", "d"}
+	if !reflect.DeepEqual(r.History(), want) {
+		t.Fatalf("History = %q, want %q", r.History(), want)
+	}
+
+	// The file is allowed to grow to twice HistorySize before it is
+	// rewritten.
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "a\nb\nc\nd\n" {
+		t.Fatalf("history file = %q, want %q", b, "a\nb\nc\nd\n")
+	}
+	r.AddHistory("e")
+	if b, _ := os.ReadFile(path); string(b) != "d\ne\n" {
+		t.Fatalf("history file = %q, want %q", b, "d\ne\n")
+	}
+}
+
+func TestHistoryFileLongLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	long := strings.Repeat("x", 2<<20)
+
+	r := NewRl()
+	r.HistoryFile = path
+	r.AddHistory(long)
+
+	r2 := NewRl()
+	r2.HistoryFile = path
+	if err := r2.loadHistoryFile(); err != nil {
+		t.Fatal(err)
+	}
+	if h := r2.History(); len(h) != 1 || h[0] != long {
+		t.Fatalf("History has %d entries, want the long line", len(h))
+	}
+}
+
+func TestUnreadableHistoryFileReportedOnce(t *testing.T) {
+	r := NewRl()
+	r.HistoryFile = t.TempDir()
+	if err := r.loadHistoryFile(); err == nil {
+		t.Fatal("loadHistoryFile of a directory succeeded")
+	}
+	if err := r.loadHistoryFile(); err != nil {
+		t.Fatalf("second loadHistoryFile = %v, want nil", err)
+	}
+}
+
+func TestHistorySearchMatchesPrefix(t *testing.T) {
+	r := NewRl()
+	for _, h := range []string{"git status", "ls", "git commit", "git commit"} {
+		r.AddHistory(h)
+	}
+	r.AddHistory("make")
+	e := &Editor{r: r, c: &ctx{input: newBuffer("git"), cursor_x: 3}, histIdx: 4}
+
+	e.historySearch(-1)
+	if e.c.input.String() != "git commit" || e.c.cursor_x != 3 {
+		t.Fatalf("first Up: input %q cursor %d, want %q cursor 3", e.c.input.String(), e.c.cursor_x, "git commit")
+	}
+	e.historySearch(-1)
+	if e.c.input.String() != "git status" {
+		t.Fatalf("second Up: input %q, want %q", e.c.input.String(), "git status")
+	}
+	e.historySearch(-1)
+	if e.c.input.String() != "git status" {
+		t.Fatalf("Up past last match: input %q, want %q", e.c.input.String(), "git status")
+	}
+
+	e.historySearch(1)
+	e.historySearch(1)
+	if e.c.input.String() != "git" || e.histIdx != 4 {
+		t.Fatalf("Down to new line: input %q at %d, want %q at 4", e.c.input.String(), e.histIdx, "git")
+	}
+}
@@ -0,0 +1,376 @@
+package rl
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxIncludeDepth bounds $include nesting so include cycles terminate.
+const maxIncludeDepth = 10
+
+// ReadInitFile reads key bindings and variable settings from a GNU readline
+// init file. An empty path means $INPUTRC, or ~/.inputrc when it is unset.
+// Lines that cannot be applied are reported to WarningFunc and skipped.
+func (r *Rl) ReadInitFile(path string) error {
+	if path == "" {
+		path = os.Getenv("INPUTRC")
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(home, ".inputrc")
+	}
+	r.initKeymaps()
+
+	p := &initParser{r: r, keymap: r.Keymap}
+	if r.Mode == ModeVi {
+		p.keymap = r.ViInsertKeymap
+	}
+	if err := p.readFile(path, 0); err != nil {
+		return err
+	}
+	r.initFile = path
+	return nil
+}
+
+func (r *Rl) warn(err error) {
+	if r.WarningFunc != nil {
+		r.WarningFunc(err)
+	}
+}
+
+type initParser struct {
+	r      *Rl
+	keymap *Keymap
+	// prefix is prepended to key sequences bound while an emacs-meta or
+	// emacs-ctlx keymap is selected.
+	prefix string
+	// conds holds, for each open $if, whether its lines are applied.
+	conds []bool
+	// taken records whether the $if or $else branch was chosen.
+	taken []bool
+}
+
+func (p *initParser) readFile(path string, depth int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		if err := p.line(path, strings.TrimSpace(sc.Text()), depth); err != nil {
+			p.r.warn(fmt.Errorf("%s:%d: %v", path, n, err))
+		}
+	}
+	return sc.Err()
+}
+
+func (p *initParser) active() bool {
+	return len(p.conds) == 0 || p.conds[len(p.conds)-1]
+}
+
+func (p *initParser) line(path, line string, depth int) error {
+	if line == "" || line[0] == '#' {
+		return nil
+	}
+
+	if line[0] == '$' {
+		directive, arg := splitWord(line[1:])
+		switch directive {
+		case "if":
+			parent := p.active()
+			ok, err := p.cond(arg)
+			p.conds = append(p.conds, parent && ok)
+			p.taken = append(p.taken, ok)
+			return err
+		case "else":
+			if len(p.conds) == 0 {
+				return fmt.Errorf("$else without $if")
+			}
+			i := len(p.conds) - 1
+			parent := i == 0 || p.conds[i-1]
+			p.conds[i] = parent && !p.taken[i]
+			return nil
+		case "endif":
+			if len(p.conds) == 0 {
+				return fmt.Errorf("$endif without $if")
+			}
+			p.conds = p.conds[:len(p.conds)-1]
+			p.taken = p.taken[:len(p.taken)-1]
+			return nil
+		case "include":
+			if !p.active() {
+				return nil
+			}
+			if depth >= maxIncludeDepth {
+				return fmt.Errorf("$include nested too deeply")
+			}
+			return p.readFile(includePath(path, arg), depth+1)
+		}
+		return fmt.Errorf("unsupported directive $%s", directive)
+	}
+
+	if !p.active() {
+		return nil
+	}
+	if word, arg := splitWord(line); word == "set" {
+		name, value := splitWord(arg)
+		return p.set(name, value)
+	}
+	return p.bind(line)
+}
+
+// cond evaluates the argument of $if.
+func (p *initParser) cond(arg string) (bool, error) {
+	switch {
+	case strings.HasPrefix(arg, "mode="):
+		return strings.TrimPrefix(arg, "mode=") == p.r.Mode.String(), nil
+	case strings.HasPrefix(arg, "term="):
+		want := strings.TrimPrefix(arg, "term=")
+		term := os.Getenv("TERM")
+		base, _, _ := strings.Cut(term, "-")
+		return term == want || base == want, nil
+	case strings.ContainsAny(arg, "=<>!"):
+		return false, fmt.Errorf("unsupported condition %q", arg)
+	}
+	return strings.EqualFold(arg, p.r.AppName), nil
+}
+
+func (p *initParser) set(name, value string) error {
+	switch strings.ToLower(name) {
+	case "editing-mode":
+		switch value {
+		case "emacs":
+			p.r.Mode, p.keymap = ModeEmacs, p.r.Keymap
+		case "vi":
+			p.r.Mode, p.keymap = ModeVi, p.r.ViInsertKeymap
+		default:
+			return fmt.Errorf("unsupported editing-mode %q", value)
+		}
+		p.prefix = ""
+	case "keymap":
+		p.prefix = ""
+		switch value {
+		case "emacs", "emacs-standard":
+			p.keymap = p.r.Keymap
+		case "emacs-meta":
+			p.keymap, p.prefix = p.r.Keymap, `\e`
+		case "emacs-ctlx":
+			p.keymap, p.prefix = p.r.Keymap, `\C-x`
+		case "vi", "vi-command", "vi-move":
+			p.keymap = p.r.ViCommandKeymap
+		case "vi-insert":
+			p.keymap = p.r.ViInsertKeymap
+		default:
+			return fmt.Errorf("unsupported keymap %q", value)
+		}
+	case "enable-bracketed-paste":
+		p.r.BracketedPaste = parseBoolVar(value)
+	case "show-mode-in-prompt":
+		p.r.ShowModeInPrompt = parseBoolVar(value)
+	case "emacs-mode-string", "vi-ins-mode-string", "vi-cmd-mode-string":
+		s, err := parseStringVar(value)
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(name) {
+		case "emacs-mode-string":
+			p.r.EmacsModeString = s
+		case "vi-ins-mode-string":
+			p.r.ViInsModeString = s
+		default:
+			p.r.ViCmdModeString = s
+		}
+	case "completion-ignore-case":
+		p.r.CompletionIgnoreCase = parseBoolVar(value)
+	case "history-size":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("bad history-size %q", value)
+		}
+		if n < 0 {
+			n = 0
+		}
+		p.r.HistorySize = n
+	case "keyseq-timeout":
+		// Like readline, a value that is not a positive number of
+		// milliseconds waits as long as it takes.
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			n = 0
+		}
+		p.r.KeyseqTimeout = time.Duration(n) * time.Millisecond
+	default:
+		return fmt.Errorf("unsupported variable %q", name)
+	}
+	return nil
+}
+
+// parseBoolVar follows readline, which treats "on" (in any case) and "1"
+// as true and everything else as false.
+func parseBoolVar(value string) bool {
+	return value == "" || strings.EqualFold(value, "on") || value == "1"
+}
+
+// parseStringVar decodes a string variable, which may be quoted and use
+// the backslash escapes of key sequences.
+func parseStringVar(value string) (string, error) {
+	if value != "" && value[0] == '"' {
+		end := closingQuote(value)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string")
+		}
+		value = value[1:end]
+	}
+	b, err := unescapeKeySeq(value)
+	return string(b), err
+}
+
+// bind handles `"keyseq": command`, `"keyseq": "macro"` and
+// `keyname: command` lines.
+func (p *initParser) bind(line string) error {
+	var seq, rest string
+	if line[0] == '"' {
+		end := closingQuote(line)
+		if end < 0 {
+			return fmt.Errorf("unterminated key sequence")
+		}
+		seq, rest = line[1:end], line[end+1:]
+	} else {
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return fmt.Errorf("missing ':' in binding")
+		}
+		var err error
+		seq, err = keynameSeq(strings.TrimSpace(line[:i]))
+		if err != nil {
+			return err
+		}
+		rest = line[i:]
+	}
+
+	rest = strings.TrimSpace(rest)
+	if !strings.HasPrefix(rest, ":") {
+		return fmt.Errorf("missing ':' in binding")
+	}
+	rest = strings.TrimSpace(rest[1:])
+	seq = p.prefix + seq
+
+	if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+		end := closingQuote(rest)
+		if end < 0 {
+			return fmt.Errorf("unterminated macro")
+		}
+		macro, err := parseKeySeq(rest[1:end])
+		if err != nil {
+			return err
+		}
+		return p.keymap.BindFunc(seq, func(e *Editor) {
+			e.keys = append(append([]Key(nil), macro...), e.keys...)
+		})
+	}
+
+	name, _ := splitWord(rest)
+	return p.keymap.Bind(seq, strings.ToLower(name))
+}
+
+// closingQuote returns the index of the quote ending the string that s
+// starts with, skipping backslash escapes.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case s[0]:
+			return i
+		}
+	}
+	return -1
+}
+
+var keynames = map[string]string{
+	"del":     `\d`,
+	"rubout":  `\d`,
+	"esc":     `\e`,
+	"escape":  `\e`,
+	"lfd":     `\n`,
+	"newline": `\n`,
+	"ret":     `\r`,
+	"return":  `\r`,
+	"space":   ` `,
+	"spc":     ` `,
+	"tab":     `\t`,
+}
+
+// keynameSeq converts a key name such as Control-u or Meta-Rubout into
+// readline key sequence notation.
+func keynameSeq(name string) (string, error) {
+	var mods string
+	for {
+		lower := strings.ToLower(name)
+		switch {
+		case strings.HasPrefix(lower, "control-"):
+			mods += `\C-`
+			name = name[len("control-"):]
+		case strings.HasPrefix(lower, "meta-"):
+			mods += `\M-`
+			name = name[len("meta-"):]
+		case strings.HasPrefix(lower, "c-") && len(name) > 2:
+			mods += `\C-`
+			name = name[2:]
+		case strings.HasPrefix(lower, "m-") && len(name) > 2:
+			mods += `\M-`
+			name = name[2:]
+		default:
+			if seq, ok := keynames[lower]; ok {
+				return mods + seq, nil
+			}
+			if len([]rune(name)) != 1 {
+				return "", fmt.Errorf("unknown key name %q", name)
+			}
+			if name == `\` || name == `"` {
+				name = `\` + name
+			}
+			return mods + name, nil
+		}
+	}
+}
+
+func includePath(from, path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(from), path)
+}
+
+func splitWord(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i+1:])
+}
+
+func reReadInitFile(e *Editor) {
+	if e.r.initFile == "" {
+		return
+	}
+	if err := e.r.ReadInitFile(e.r.initFile); err != nil {
+		e.r.warn(err)
+	}
+}
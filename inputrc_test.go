@@ -0,0 +1,137 @@
+package rl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeInitFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadInitFile(t *testing.T) {
+	dir := t.TempDir()
+	writeInitFile(t, dir, "extra", `"\C-xe": end-of-line`+"\n")
+	path := writeInitFile(t, dir, "inputrc", `
+# comment
+set completion-ignore-case on
+set history-size 50
+set keyseq-timeout 200
+"\C-x\C-b": backward-word
+Control-o: accept-and-hold
+$if myapp
+"\eOQ": "hello"
+$else
+"\eOQ": kill-line
+$endif
+$if mode=emacs
+set keymap emacs-meta
+"z": undo
+set keymap emacs
+$endif
+$include extra
+`)
+
+	r := NewRl()
+	r.AppName = "MyApp"
+	var warnings []error
+	r.WarningFunc = func(err error) { warnings = append(warnings, err) }
+	if err := r.ReadInitFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("unexpected warnings: %v", warnings)
+	}
+	if !r.CompletionIgnoreCase || r.HistorySize != 50 || r.KeyseqTimeout != 200*time.Millisecond {
+		t.Fatalf("variables not applied: ignore case %v, history size %d, keyseq timeout %v",
+			r.CompletionIgnoreCase, r.HistorySize, r.KeyseqTimeout)
+	}
+
+	for seq, name := range map[string]string{
+		`\C-x\C-b`: "backward-word",
+		`\C-o`:     "accept-and-hold",
+		`\ez`:      "undo",
+		`\C-xe`:    "end-of-line",
+	} {
+		if got := boundName(t, r.Keymap, seq); got != name {
+			t.Fatalf("%s bound to %q, want %q", seq, got, name)
+		}
+	}
+
+	e := &Editor{r: r, c: &ctx{}}
+	e.dispatch(r.Keymap, Key{Code: KeyF2})
+	for len(e.keys) > 0 {
+		k := e.keys[0]
+		e.keys = e.keys[1:]
+		e.dispatch(r.Keymap, k)
+	}
+	if e.Line() != "hello" {
+		t.Fatalf("macro inserted %q, want %q", e.Line(), "hello")
+	}
+}
+
+func TestReadInitFileWarnsAboutUnsupportedLines(t *testing.T) {
+	path := writeInitFile(t, t.TempDir(), "inputrc", `
+set no-such-variable on
+$frobnicate
+"\C-a": no-such-command
+"\C-b": forward-char
+`)
+
+	r := NewRl()
+	var warnings []string
+	r.WarningFunc = func(err error) { warnings = append(warnings, err.Error()) }
+	if err := r.ReadInitFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 3 {
+		t.Fatalf("got %d warnings %q, want 3", len(warnings), warnings)
+	}
+	if !strings.HasPrefix(warnings[0], path+":2: ") {
+		t.Fatalf("warning %q does not carry file and line", warnings[0])
+	}
+	if got := boundName(t, r.Keymap, `\C-b`); got != "forward-char" {
+		t.Fatalf(`\C-b bound to %q after warnings, want "forward-char"`, got)
+	}
+}
+
+func TestReadInitFileHonorsINPUTRC(t *testing.T) {
+	path := writeInitFile(t, t.TempDir(), "inputrc", `"\C-t": kill-line`+"\n")
+	t.Setenv("INPUTRC", path)
+
+	r := NewRl()
+	if err := r.ReadInitFile(""); err != nil {
+		t.Fatal(err)
+	}
+	if got := boundName(t, r.Keymap, `\C-t`); got != "kill-line" {
+		t.Fatalf(`\C-t bound to %q, want "kill-line"`, got)
+	}
+}
+
+func boundName(t *testing.T, m *Keymap, seq string) string {
+	t.Helper()
+	ks, err := parseKeySeq(seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b *binding
+	for _, k := range ks {
+		if m == nil {
+			return ""
+		}
+		b = m.bindings[k]
+		if b == nil {
+			return ""
+		}
+		m = b.next
+	}
+	return b.name
+}
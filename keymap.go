@@ -0,0 +1,291 @@
+package rl
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// UnknownCommandError is returned when binding or running a command name
+// that does not exist.
+type UnknownCommandError struct {
+	Name string
+}
+
+func (e *UnknownCommandError) Error() string {
+	return "rl: unknown command " + strconv.Quote(e.Name)
+}
+
+// Keymap maps key sequences to editing commands.
+type Keymap struct {
+	bindings map[Key]*binding
+	// noInsert makes unbound character keys do nothing, as in vi command
+	// mode.
+	noInsert bool
+}
+
+type binding struct {
+	name string
+	fn   func(*Editor)
+	// next holds the continuations when the key is a prefix of longer
+	// sequences, like Ctrl-X in Ctrl-X Ctrl-U.
+	next *Keymap
+}
+
+// NewKeymap returns a keymap without any bindings. Unbound character keys
+// are still inserted into the line.
+func NewKeymap() *Keymap {
+	return &Keymap{bindings: map[Key]*binding{}}
+}
+
+var emacsBindings = []struct {
+	seq  string
+	name string
+}{
+	{`\C-a`, "beginning-of-line"},
+	{`\e[H`, "beginning-of-line"},
+	{`\C-e`, "end-of-line"},
+	{`\e[F`, "end-of-line"},
+	{`\C-b`, "backward-char"},
+	{`\e[D`, "backward-char"},
+	{`\C-f`, "forward-char"},
+	{`\e[C`, "forward-char"},
+	{`\eb`, "backward-word"},
+	{`\e[1;5D`, "backward-word"},
+	{`\ef`, "forward-word"},
+	{`\e[1;5C`, "forward-word"},
+	{`\C-j`, "accept-line"},
+	{`\C-m`, "accept-line"},
+	{`\C-c`, "interrupt"},
+	{`\C-d`, "end-of-file"},
+	{`\e[3~`, "delete-char"},
+	{`\C-h`, "backward-delete-char"},
+	{`\C-?`, "backward-delete-char"},
+	{`\C-i`, "complete"},
+	{`\C-v`, "quoted-insert"},
+	{`\e[200~`, "bracketed-paste-begin"},
+	{`\C-l`, "clear-screen"},
+	{`\C-p`, "previous-history"},
+	{`\e[A`, "previous-history"},
+	{`\C-n`, "next-history"},
+	{`\e[B`, "next-history"},
+	{`\C-r`, "reverse-search-history"},
+	{`\C-s`, "forward-search-history"},
+	{`\C-k`, "kill-line"},
+	{`\C-u`, "unix-line-discard"},
+	{`\C-w`, "unix-word-rubout"},
+	{`\ed`, "kill-word"},
+	{`\e\C-?`, "backward-kill-word"},
+	{`\C-y`, "yank"},
+	{`\ey`, "yank-pop"},
+	{`\C-_`, "undo"},
+	{`\C-x\C-u`, "undo"},
+	{`\C-^`, "redo"},
+	{`\er`, "revert-line"},
+	{`\C-t`, "transpose-chars"},
+	{`\et`, "transpose-words"},
+	{`\eu`, "upcase-word"},
+	{`\el`, "downcase-word"},
+	{`\ec`, "capitalize-word"},
+	{`\C-x\C-r`, "re-read-init-file"},
+	{`\C-x(`, "start-kbd-macro"},
+	{`\C-x)`, "end-kbd-macro"},
+	{`\C-xe`, "call-last-kbd-macro"},
+	{`\e-`, "digit-argument"},
+	{`\e0`, "digit-argument"},
+	{`\e1`, "digit-argument"},
+	{`\e2`, "digit-argument"},
+	{`\e3`, "digit-argument"},
+	{`\e4`, "digit-argument"},
+	{`\e5`, "digit-argument"},
+	{`\e6`, "digit-argument"},
+	{`\e7`, "digit-argument"},
+	{`\e8`, "digit-argument"},
+	{`\e9`, "digit-argument"},
+}
+
+// EmacsKeymap returns a new keymap holding the default Emacs style
+// bindings, ready to be extended with Bind and BindFunc.
+func EmacsKeymap() *Keymap {
+	m := NewKeymap()
+	for _, b := range emacsBindings {
+		if err := m.Bind(b.seq, b.name); err != nil {
+			panic(err)
+		}
+	}
+	return m
+}
+
+// Bind binds the key sequence seq to the named command. seq uses GNU
+// readline notation: `\C-x` for Control, `\M-x` or `\e` for Meta/Escape,
+// the usual backslash escapes, and raw terminal sequences such as `\e[A`
+// (Up) or `\eOQ` (F2).
+func (m *Keymap) Bind(seq, name string) error {
+	fn, ok := commands[name]
+	if !ok {
+		return &UnknownCommandError{Name: name}
+	}
+	return m.bind(seq, name, fn)
+}
+
+// BindFunc binds the key sequence seq, in the notation accepted by Bind,
+// to fn.
+func (m *Keymap) BindFunc(seq string, fn func(e *Editor)) error {
+	return m.bind(seq, "", fn)
+}
+
+// Unbind removes the binding for seq.
+func (m *Keymap) Unbind(seq string) error {
+	ks, err := parseKeySeq(seq)
+	if err != nil {
+		return err
+	}
+	for i, k := range ks {
+		b := m.bindings[k]
+		if b == nil {
+			return nil
+		}
+		if i == len(ks)-1 {
+			delete(m.bindings, k)
+			return nil
+		}
+		if b.next == nil {
+			return nil
+		}
+		m = b.next
+	}
+	return nil
+}
+
+func (m *Keymap) bind(seq, name string, fn func(*Editor)) error {
+	ks, err := parseKeySeq(seq)
+	if err != nil {
+		return err
+	}
+	for _, k := range ks[:len(ks)-1] {
+		b := m.bindings[k]
+		if b == nil || b.next == nil {
+			b = &binding{next: NewKeymap()}
+			m.bindings[k] = b
+		}
+		m = b.next
+	}
+	m.bindings[ks[len(ks)-1]] = &binding{name: name, fn: fn}
+	return nil
+}
+
+// parseKeySeq converts a key sequence in readline notation into keys.
+func parseKeySeq(seq string) ([]Key, error) {
+	b, err := unescapeKeySeq(seq)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("rl: empty key sequence")
+	}
+
+	var ks []Key
+	for len(b) > 0 {
+		k, n, ok := decodeKey(b, true)
+		if ok {
+			ks = append(ks, k)
+		}
+		b = b[n:]
+	}
+	if len(ks) == 0 {
+		return nil, fmt.Errorf("rl: unknown key sequence %q", seq)
+	}
+	return ks, nil
+}
+
+var keySeqEscapes = map[byte]byte{
+	'a':  0x07,
+	'b':  0x08,
+	'd':  0x7f,
+	'e':  0x1b,
+	'f':  0x0c,
+	'n':  0x0a,
+	'r':  0x0d,
+	't':  0x09,
+	'v':  0x0b,
+	'\\': '\\',
+	'"':  '"',
+	'\'': '\'',
+}
+
+func unescapeKeySeq(seq string) ([]byte, error) {
+	var out []byte
+	for i := 0; i < len(seq); {
+		b, n, err := unescapeKey(seq, i)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+		i = n
+	}
+	return out, nil
+}
+
+// unescapeKey decodes the single key written at seq[i:], which may carry
+// \C- and \M- modifiers, and returns its bytes and the index following it.
+func unescapeKey(seq string, i int) ([]byte, int, error) {
+	if seq[i] != '\\' {
+		return []byte{seq[i]}, i + 1, nil
+	}
+	if i+1 == len(seq) {
+		return nil, 0, fmt.Errorf("rl: trailing backslash in key sequence %q", seq)
+	}
+	i++
+
+	switch c := seq[i]; {
+	case (c == 'C' || c == 'M') && i+1 < len(seq) && seq[i+1] == '-':
+		if i+2 == len(seq) {
+			return nil, 0, fmt.Errorf("rl: missing key after modifier in %q", seq)
+		}
+		b, n, err := unescapeKey(seq, i+2)
+		if err != nil {
+			return nil, 0, err
+		}
+		if c == 'M' {
+			return append([]byte{0x1b}, b...), n, nil
+		}
+		b[len(b)-1] = controlByte(b[len(b)-1])
+		return b, n, nil
+	case c >= '0' && c <= '7':
+		v, j := 0, i
+		for j < len(seq) && j < i+3 && seq[j] >= '0' && seq[j] <= '7' {
+			v = v*8 + int(seq[j]-'0')
+			j++
+		}
+		return []byte{byte(v)}, j, nil
+	case c == 'x':
+		j := i + 1
+		for j < len(seq) && j < i+3 && isHexDigit(seq[j]) {
+			j++
+		}
+		v, err := strconv.ParseUint(seq[i+1:j], 16, 8)
+		if err != nil {
+			return nil, 0, fmt.Errorf("rl: bad hex escape in key sequence %q", seq)
+		}
+		return []byte{byte(v)}, j, nil
+	}
+
+	if b, ok := keySeqEscapes[seq[i]]; ok {
+		return []byte{b}, i + 1, nil
+	}
+	return []byte{seq[i]}, i + 1, nil
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// controlByte returns the byte typed by holding Control with c.
+func controlByte(c byte) byte {
+	if c == '?' {
+		return 0x7f
+	}
+	if c >= 'a' && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+	return c & 0x1f
+}
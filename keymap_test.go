@@ -0,0 +1,138 @@
+package rl
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseKeySeq(t *testing.T) {
+	tests := []struct {
+		seq  string
+		want []Key
+	}{
+		{`\C-x\C-r`, []Key{ctrlKey('x'), ctrlKey('r')}},
+		{`\M-b`, []Key{altKey('b')}},
+		{`\eb`, []Key{altKey('b')}},
+		{`\e\C-?`, []Key{{Code: KeyBackspace, Alt: true}}},
+		{`\C-i`, []Key{{Code: KeyTab}}},
+		{`\e[A`, []Key{{Code: KeyUp}}},
+		{`\eOQ`, []Key{{Code: KeyF2}}},
+		{`\e[1;5C`, []Key{{Code: KeyRight, Ctrl: true}}},
+		{`\C-j`, []Key{ctrlKey('j')}},
+		{`\x01\001`, []Key{ctrlKey('a'), ctrlKey('a')}},
+		{`ab`, []Key{{Rune: 'a'}, {Rune: 'b'}}},
+	}
+
+	for _, tt := range tests {
+		got, err := parseKeySeq(tt.seq)
+		if err != nil {
+			t.Fatalf("parseKeySeq(%q): %v", tt.seq, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("parseKeySeq(%q) = %v, want %v", tt.seq, got, tt.want)
+		}
+	}
+}
+
+func TestBindUnknownCommand(t *testing.T) {
+	err := NewKeymap().Bind(`\C-a`, "no-such-command")
+	var uerr *UnknownCommandError
+	if !errors.As(err, &uerr) || uerr.Name != "no-such-command" {
+		t.Fatalf("Bind = %v, want UnknownCommandError", err)
+	}
+}
+
+func TestDispatchPrefixAndFunc(t *testing.T) {
+	km := EmacsKeymap()
+	if err := km.BindFunc(`\eOQ`, func(e *Editor) { e.Insert("TICKET-1") }); err != nil {
+		t.Fatal(err)
+	}
+	if err := km.Bind(`\C-x\C-e`, "end-of-line"); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &Editor{r: NewRl(), c: &ctx{input: newBuffer("fix "), cursor_x: 0}}
+	e.keys = []Key{ctrlKey('e')}
+	e.dispatch(km, ctrlKey('x'))
+	if e.Cursor() != 4 {
+		t.Fatalf("Ctrl-X Ctrl-E cursor = %d, want 4", e.Cursor())
+	}
+	e.dispatch(km, Key{Code: KeyF2})
+	e.dispatch(km, Key{Rune: '!'})
+	if e.Line() != "fix TICKET-1!" {
+		t.Fatalf("line = %q, want %q", e.Line(), "fix TICKET-1!")
+	}
+
+	// The existing Ctrl-X Ctrl-U binding shares the prefix.
+	e.keys = []Key{ctrlKey('u')}
+	e.dispatch(km, ctrlKey('x'))
+	if e.thisCmd != cmdUndo {
+		t.Fatal("Ctrl-X Ctrl-U did not run undo")
+	}
+}
+
+func TestEditorKey(t *testing.T) {
+	r := NewRl()
+	var got []Key
+	for _, seq := range []string{`\eOQ`, `\M-x`, `\C-xk`} {
+		if err := r.Keymap.BindFunc(seq, func(e *Editor) { got = append(got, e.Key()) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := &Editor{r: r, c: &ctx{}}
+	runKeys(e, DecodeKeys([]byte("\x1bOQ\x1bx\x18k"))...)
+	want := []Key{{Code: KeyF2}, altKey('x'), ctrlKey('x')}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Key = %v, want %v", got, want)
+	}
+}
+
+func TestUnbind(t *testing.T) {
+	km := EmacsKeymap()
+	if err := km.Unbind(`\C-k`); err != nil {
+		t.Fatal(err)
+	}
+	e := &Editor{r: NewRl(), c: &ctx{input: newBuffer("abc"), cursor_x: 0}}
+	e.dispatch(km, ctrlKey('k'))
+	if e.Line() != "abc" {
+		t.Fatalf("unbound Ctrl-K changed line to %q", e.Line())
+	}
+}
+
+func TestUnfinishedCharacterBindingInserts(t *testing.T) {
+	e := searchEditor("")
+	if err := e.r.Keymap.Bind("jk", "accept-line"); err != nil {
+		t.Fatal(err)
+	}
+	e.keys = typeKeys("ja")
+	for len(e.keys) > 0 {
+		k, _ := e.readKey()
+		e.handleKey(k)
+	}
+	if e.c.input.String() != "ja" || e.state != stateEditing {
+		t.Fatalf("got %q state %d, want %q still editing", e.c.input.String(), e.state, "ja")
+	}
+}
+
+func TestEscapeGivesNextKeyAlt(t *testing.T) {
+	esc := Key{Code: KeyEscape}
+	tests := []struct {
+		cursor     int
+		keys       []Key
+		want       string
+		cursorWant int
+	}{
+		{7, []Key{esc, {Rune: 'b'}}, "one two", 4},
+		{0, []Key{esc, {Rune: 'd'}}, " two", 0},
+		{7, []Key{esc, {Rune: '2'}, esc, {Rune: 'b'}}, "one two", 0},
+	}
+	for _, tt := range tests {
+		e := searchEditor("one two")
+		e.c.cursor_x = tt.cursor
+		runKeys(e, tt.keys...)
+		if e.c.input.String() != tt.want || e.c.cursor_x != tt.cursorWant {
+			t.Errorf("%v = %q cursor %d, want %q cursor %d", tt.keys, e.c.input.String(), e.c.cursor_x, tt.want, tt.cursorWant)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package rl
+
+import "unicode/utf8"
+
+// KeyCode names a key that does not produce a character.
+type KeyCode int
+
+const (
+	KeyRune KeyCode = iota
+	KeyUp
+	KeyDown
+	KeyRight
+	KeyLeft
+	KeyHome
+	KeyEnd
+	KeyInsert
+	KeyDelete
+	KeyPageUp
+	KeyPageDown
+	KeyEscape
+	KeyTab
+	KeyEnter
+	KeyBackspace
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+	// KeyPasteStart and KeyPasteEnd surround text pasted into a terminal in
+	// bracketed paste mode.
+	KeyPasteStart
+	KeyPasteEnd
+)
+
+var keyNames = map[KeyCode]string{
+	KeyUp:         "Up",
+	KeyDown:       "Down",
+	KeyRight:      "Right",
+	KeyLeft:       "Left",
+	KeyHome:       "Home",
+	KeyEnd:        "End",
+	KeyInsert:     "Insert",
+	KeyDelete:     "Delete",
+	KeyPageUp:     "PageUp",
+	KeyPageDown:   "PageDown",
+	KeyEscape:     "Escape",
+	KeyTab:        "Tab",
+	KeyEnter:      "Enter",
+	KeyBackspace:  "Backspace",
+	KeyF1:         "F1",
+	KeyF2:         "F2",
+	KeyF3:         "F3",
+	KeyF4:         "F4",
+	KeyF5:         "F5",
+	KeyF6:         "F6",
+	KeyF7:         "F7",
+	KeyF8:         "F8",
+	KeyF9:         "F9",
+	KeyF10:        "F10",
+	KeyF11:        "F11",
+	KeyF12:        "F12",
+	KeyPasteStart: "PasteStart",
+	KeyPasteEnd:   "PasteEnd",
+}
+
+// Key is a single key press. Character keys have Code set to KeyRune and
+// carry the character in Rune. Control characters are reported as the
+// lower case letter (or punctuation) with Ctrl set, so Ctrl-A is
+// Key{Rune: 'a', Ctrl: true}. Tab, Enter, Backspace and Escape are named
+// keys.
+type Key struct {
+	Rune  rune
+	Code  KeyCode
+	Ctrl  bool
+	Alt   bool
+	Shift bool
+}
+
+func (k Key) String() string {
+	var s string
+	if k.Ctrl {
+		s += "C-"
+	}
+	if k.Alt {
+		s += "M-"
+	}
+	if k.Shift {
+		s += "S-"
+	}
+	if k.Code == KeyRune {
+		return s + string(k.Rune)
+	}
+	return s + keyNames[k.Code]
+}
+
+func ctrlKey(r rune) Key {
+	return Key{Rune: r, Ctrl: true}
+}
+
+func altKey(r rune) Key {
+	return Key{Rune: r, Alt: true}
+}
+
+// runeKey returns the key for a character read from the terminal,
+// translating control characters into named keys or Ctrl combinations.
+func runeKey(r rune) Key {
+	switch r {
+	case 9:
+		return Key{Code: KeyTab}
+	case 13:
+		return Key{Code: KeyEnter}
+	case 8, 0x7f:
+		return Key{Code: KeyBackspace}
+	case 0x1b:
+		return Key{Code: KeyEscape}
+	case 0:
+		return ctrlKey('@')
+	}
+	if r < 0x1b {
+		return ctrlKey('a' + r - 1)
+	}
+	if r < 0x20 {
+		return ctrlKey(r + '@')
+	}
+	return Key{Rune: r}
+}
+
+// keyRunes returns the characters that type k, reversing runeKey, or nil
+// for keys such as the arrows that are not a character.
+func keyRunes(k Key) []rune {
+	var r rune
+	switch {
+	case k.Code == KeyRune && k.Ctrl && k.Rune == '?':
+		r = 0x7f
+	case k.Code == KeyRune && k.Ctrl && k.Rune >= 'a' && k.Rune <= 'z':
+		r = k.Rune - 'a' + 1
+	case k.Code == KeyRune && k.Ctrl && k.Rune >= '@' && k.Rune <= '_':
+		r = k.Rune - '@'
+	case k.Code == KeyRune && !k.Ctrl:
+		r = k.Rune
+	case k.Code == KeyTab:
+		r = 9
+	case k.Code == KeyEnter:
+		r = 13
+	case k.Code == KeyBackspace:
+		r = 0x7f
+	case k.Code == KeyEscape:
+		r = 0x1b
+	default:
+		return nil
+	}
+	if k.Alt {
+		return []rune{0x1b, r}
+	}
+	return []rune{r}
+}
+
+// tildeKeys maps the numeric parameter of "CSI n ~" sequences.
+var tildeKeys = map[int]KeyCode{
+	1:   KeyHome,
+	2:   KeyInsert,
+	3:   KeyDelete,
+	4:   KeyEnd,
+	5:   KeyPageUp,
+	6:   KeyPageDown,
+	7:   KeyHome,
+	8:   KeyEnd,
+	11:  KeyF1,
+	12:  KeyF2,
+	13:  KeyF3,
+	14:  KeyF4,
+	15:  KeyF5,
+	17:  KeyF6,
+	18:  KeyF7,
+	19:  KeyF8,
+	20:  KeyF9,
+	21:  KeyF10,
+	23:  KeyF11,
+	24:  KeyF12,
+	200: KeyPasteStart,
+	201: KeyPasteEnd,
+}
+
+// letterKeys maps the final byte of CSI and SS3 sequences.
+var letterKeys = map[byte]KeyCode{
+	'A': KeyUp,
+	'B': KeyDown,
+	'C': KeyRight,
+	'D': KeyLeft,
+	'H': KeyHome,
+	'F': KeyEnd,
+	'P': KeyF1,
+	'Q': KeyF2,
+	'R': KeyF3,
+	'S': KeyF4,
+}
+
+// DecodeKeys returns the key presses in b, bytes as read from a terminal,
+// decoded as ReadLine decodes them. A sequence cut short at the end of b
+// is decoded as far as it goes, so a lone ESC is the Escape key. It lets
+// tests build the keys that a recorded session or escape sequence gives.
+func DecodeKeys(b []byte) []Key {
+	ks, _ := decodeKeys(b, true)
+	return ks
+}
+
+// decodeKeys splits buf into key events. Incomplete UTF-8 or escape
+// sequences at the end of buf are returned as pending bytes to be prefixed
+// to the next read. When flush is set nothing is kept back, so a lone ESC
+// is reported as the Escape key. A line feed, which only arrives as
+// Ctrl-J since ICRNL is cleared, is decoded like any other control
+// character and left to the keymap.
+func decodeKeys(buf []byte, flush bool) ([]Key, []byte) {
+	var ks []Key
+	i := 0
+	for i < len(buf) {
+		k, n, ok := decodeKey(buf[i:], flush)
+		if n == 0 {
+			return ks, append([]byte(nil), buf[i:]...)
+		}
+		if ok {
+			ks = append(ks, k)
+		}
+		i += n
+	}
+	return ks, nil
+}
+
+// decodeKey decodes the key at the start of buf and reports how many bytes
+// it used. n is zero when more input is needed; ok is false when the bytes
+// form a sequence that should be consumed but has no key attached.
+func decodeKey(buf []byte, flush bool) (k Key, n int, ok bool) {
+	if buf[0] != 0x1b {
+		r, size := utf8.DecodeRune(buf)
+		if r == utf8.RuneError && size == 1 && !utf8.FullRune(buf) && !flush {
+			return Key{}, 0, false
+		}
+		return runeKey(r), size, true
+	}
+
+	if len(buf) == 1 {
+		if !flush {
+			return Key{}, 0, false
+		}
+		return Key{Code: KeyEscape}, 1, true
+	}
+
+	switch buf[1] {
+	case '[':
+		k, n, ok = decodeCSI(buf)
+	case 'O':
+		k, n, ok = decodeSS3(buf)
+	default:
+		// ESC followed by another key is the Meta (Alt) prefix.
+		k, n, ok = decodeKey(buf[1:], flush)
+		if n > 0 {
+			k.Alt = true
+			n++
+		}
+	}
+	if n == 0 && flush {
+		return Key{Code: KeyEscape}, 1, true
+	}
+	return k, n, ok
+}
+
+func decodeCSI(buf []byte) (Key, int, bool) {
+	// The Linux console sends "ESC [ [ A" through "ESC [ [ E" for F1-F5.
+	if len(buf) > 2 && buf[2] == '[' {
+		if len(buf) < 4 {
+			return Key{}, 0, false
+		}
+		if buf[3] >= 'A' && buf[3] <= 'E' {
+			return Key{Code: KeyF1 + KeyCode(buf[3]-'A')}, 4, true
+		}
+		return Key{}, 4, false
+	}
+
+	i := 2
+	for i < len(buf) && buf[i] >= 0x20 && buf[i] <= 0x3f {
+		i++
+	}
+	if i == len(buf) {
+		return Key{}, 0, false
+	}
+	final := buf[i]
+	n := i + 1
+	if final < 0x40 || final > 0x7e {
+		return Key{}, n, false
+	}
+
+	params := parseParams(buf[2:i])
+	var k Key
+	if final == '~' {
+		if len(params) == 0 {
+			return Key{}, n, false
+		}
+		code, found := tildeKeys[params[0]]
+		if !found {
+			return Key{}, n, false
+		}
+		k.Code = code
+	} else if final == 'Z' {
+		k = Key{Code: KeyTab, Shift: true}
+	} else {
+		code, found := letterKeys[final]
+		if !found {
+			return Key{}, n, false
+		}
+		k.Code = code
+	}
+	if len(params) > 1 {
+		applyModifier(&k, params[1])
+	}
+	return k, n, true
+}
+
+func decodeSS3(buf []byte) (Key, int, bool) {
+	i := 2
+	for i < len(buf) && buf[i] >= '0' && buf[i] <= '9' {
+		i++
+	}
+	if i == len(buf) {
+		return Key{}, 0, false
+	}
+	code, found := letterKeys[buf[i]]
+	if !found {
+		return Key{}, i + 1, false
+	}
+	k := Key{Code: code}
+	if params := parseParams(buf[2:i]); len(params) > 0 {
+		applyModifier(&k, params[0])
+	}
+	return k, i + 1, true
+}
+
+// parseParams parses the ';' separated numeric parameters of a control
+// sequence. Missing parameters are reported as zero.
+func parseParams(b []byte) []int {
+	if len(b) == 0 {
+		return nil
+	}
+	params := []int{0}
+	for _, c := range b {
+		switch {
+		case c >= '0' && c <= '9':
+			params[len(params)-1] = params[len(params)-1]*10 + int(c-'0')
+		case c == ';':
+			params = append(params, 0)
+		}
+	}
+	return params
+}
+
+// applyModifier applies an xterm modifier parameter (1 + bitmask of
+// Shift=1, Alt=2, Ctrl=4, Meta=8) to k.
+func applyModifier(k *Key, param int) {
+	if param < 2 {
+		return
+	}
+	m := param - 1
+	k.Shift = m&1 != 0
+	k.Alt = m&2 != 0 || m&8 != 0
+	k.Ctrl = m&4 != 0
+}
@@ -0,0 +1,173 @@
+package rl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Key
+	}{
+		{
+			name:  "plain text",
+			input: "aあ",
+			want:  []Key{{Rune: 'a'}, {Rune: 'あ'}},
+		},
+		{
+			name:  "csi arrows",
+			input: "\x1b[A\x1b[B\x1b[C\x1b[D",
+			want:  []Key{{Code: KeyUp}, {Code: KeyDown}, {Code: KeyRight}, {Code: KeyLeft}},
+		},
+		{
+			name:  "ss3 arrows and function keys",
+			input: "\x1bOH\x1bOF\x1bOP\x1bOS",
+			want:  []Key{{Code: KeyHome}, {Code: KeyEnd}, {Code: KeyF1}, {Code: KeyF4}},
+		},
+		{
+			name:  "tilde sequences",
+			input: "\x1b[2~\x1b[3~\x1b[5~\x1b[6~\x1b[15~\x1b[24~",
+			want:  []Key{{Code: KeyInsert}, {Code: KeyDelete}, {Code: KeyPageUp}, {Code: KeyPageDown}, {Code: KeyF5}, {Code: KeyF12}},
+		},
+		{
+			name:  "xterm modifiers",
+			input: "\x1b[1;5C\x1b[1;3D\x1b[1;2A\x1b[3;5~",
+			want: []Key{
+				{Code: KeyRight, Ctrl: true},
+				{Code: KeyLeft, Alt: true},
+				{Code: KeyUp, Shift: true},
+				{Code: KeyDelete, Ctrl: true},
+			},
+		},
+		{
+			name:  "meta prefix",
+			input: "\x1bb\x1b\x1b[A",
+			want:  []Key{{Rune: 'b', Alt: true}, {Code: KeyUp, Alt: true}},
+		},
+		{
+			name:  "linux console function keys",
+			input: "\x1b[[A\x1b[[E",
+			want:  []Key{{Code: KeyF1}, {Code: KeyF5}},
+		},
+		{
+			name:  "unknown sequences are dropped",
+			input: "\x1b[99~x",
+			want:  []Key{{Rune: 'x'}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, pending := decodeKeys([]byte(tt.input), false)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("decodeKeys(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+			if len(pending) != 0 {
+				t.Fatalf("decodeKeys(%q) pending = %q, want none", tt.input, pending)
+			}
+		})
+	}
+}
+
+func TestDecodeKeysLoneEscape(t *testing.T) {
+	ks, pending := decodeKeys([]byte("a\x1b"), false)
+	if !reflect.DeepEqual(ks, []Key{{Rune: 'a'}}) {
+		t.Fatalf("decodeKeys = %v, want only 'a'", ks)
+	}
+	if string(pending) != "\x1b" {
+		t.Fatalf("decodeKeys pending = %q, want ESC", pending)
+	}
+
+	ks, pending = decodeKeys(pending, true)
+	if !reflect.DeepEqual(ks, []Key{{Code: KeyEscape}}) {
+		t.Fatalf("decodeKeys flush = %v, want Escape", ks)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("decodeKeys flush pending = %q, want none", pending)
+	}
+}
+
+func TestDecodeKeysSplitSequence(t *testing.T) {
+	ks, pending := decodeKeys([]byte("\x1b[1;"), false)
+	if len(ks) != 0 {
+		t.Fatalf("decodeKeys = %v, want none", ks)
+	}
+	ks, _ = decodeKeys(append(pending, "5D"...), false)
+	if !reflect.DeepEqual(ks, []Key{{Code: KeyLeft, Ctrl: true}}) {
+		t.Fatalf("decodeKeys = %v, want Ctrl-Left", ks)
+	}
+}
+
+func TestRuneKey(t *testing.T) {
+	tests := []struct {
+		r    rune
+		want Key
+	}{
+		{'a', Key{Rune: 'a'}},
+		{1, Key{Rune: 'a', Ctrl: true}},
+		{23, Key{Rune: 'w', Ctrl: true}},
+		{0x1f, Key{Rune: '_', Ctrl: true}},
+		{9, Key{Code: KeyTab}},
+		{13, Key{Code: KeyEnter}},
+		{0x7f, Key{Code: KeyBackspace}},
+	}
+
+	for _, tt := range tests {
+		if got := runeKey(tt.r); got != tt.want {
+			t.Fatalf("runeKey(%q) = %v, want %v", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeKeysMetaBackspace(t *testing.T) {
+	ks, _ := decodeKeys([]byte("\x1b\x7f\x17"), false)
+	want := []Key{{Code: KeyBackspace, Alt: true}, {Rune: 'w', Ctrl: true}}
+	if !reflect.DeepEqual(ks, want) {
+		t.Fatalf("decodeKeys = %v, want %v", ks, want)
+	}
+}
+
+func TestKeyRunesReversesRuneKey(t *testing.T) {
+	for r := rune(0); r < 0x80; r++ {
+		if r == 8 {
+			// Backspace and DEL decode to the same key.
+			continue
+		}
+		rs := keyRunes(runeKey(r))
+		if len(rs) != 1 || rs[0] != r {
+			t.Errorf("keyRunes(runeKey(%#x)) = %q", r, rs)
+		}
+	}
+	if rs := keyRunes(altKey('x')); string(rs) != "\x1bx" {
+		t.Errorf("keyRunes(M-x) = %q, want %q", rs, "\x1bx")
+	}
+	if rs := keyRunes(Key{Code: KeyUp}); rs != nil {
+		t.Errorf("keyRunes(Up) = %q, want nil", rs)
+	}
+}
+
+func TestDecodeKeysBracketedPaste(t *testing.T) {
+	ks, pending := decodeKeys([]byte("\x1b[200~a\n\tb\x1b[201~"), false)
+	want := []Key{{Code: KeyPasteStart}, {Rune: 'a'}, ctrlKey('j'), {Code: KeyTab}, {Rune: 'b'}, {Code: KeyPasteEnd}}
+	if !reflect.DeepEqual(ks, want) || len(pending) != 0 {
+		t.Fatalf("decodeKeys = %v pending %q, want %v", ks, pending, want)
+	}
+}
+
+func TestDecodeKeysExported(t *testing.T) {
+	ks := DecodeKeys([]byte("a\x1b[1;5D\x1bb\x1b"))
+	want := []Key{{Rune: 'a'}, {Code: KeyLeft, Ctrl: true}, altKey('b'), {Code: KeyEscape}}
+	if !reflect.DeepEqual(ks, want) {
+		t.Fatalf("DecodeKeys = %v, want %v", ks, want)
+	}
+}
+
+func TestDecodeKeysLineFeed(t *testing.T) {
+	ks, _ := decodeKeys([]byte("\x16\na\n"), false)
+	want := []Key{ctrlKey('v'), ctrlKey('j'), {Rune: 'a'}, ctrlKey('j')}
+	if !reflect.DeepEqual(ks, want) {
+		t.Fatalf("decodeKeys = %v, want %v", ks, want)
+	}
+}
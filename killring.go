@@ -0,0 +1,74 @@
+package rl
+
+// killRingSize is the number of killed texts kept for yanking.
+const killRingSize = 60
+
+// pushKill records text on the kill ring. When merge is set the text joins
+// the most recent entry instead, in front of it if prepend is set.
+func pushKill(ring []string, text string, merge, prepend bool) []string {
+	if merge && len(ring) > 0 {
+		if prepend {
+			ring[len(ring)-1] = text + ring[len(ring)-1]
+		} else {
+			ring[len(ring)-1] += text
+		}
+		return ring
+	}
+	ring = append(ring, text)
+	if len(ring) > killRingSize {
+		ring = ring[len(ring)-killRingSize:]
+	}
+	return ring
+}
+
+// kill removes input[start:end] and saves it on the kill ring. Consecutive
+// kills are collected into a single entry; backward kills are prepended
+// so the entry reads in line order.
+func (e *Editor) kill(start, end int, backward bool) {
+	if start < 0 || end > e.c.input.len() || start >= end {
+		e.thisCmd = cmdKill
+		return
+	}
+	text := string(e.c.input.slice(start, end))
+	e.c.input.delete(start, end)
+	e.c.cursor_x = start
+	e.dirty = true
+	if !e.password {
+		e.r.killRing = pushKill(e.r.killRing, text, e.lastCmd == cmdKill, backward)
+	}
+	e.thisCmd = cmdKill
+}
+
+// yank inserts the most recently killed text at the cursor.
+func (e *Editor) yank() {
+	if len(e.r.killRing) == 0 {
+		return
+	}
+	e.yankIdx = len(e.r.killRing) - 1
+	e.yankStart = e.c.cursor_x
+	e.insertYank()
+}
+
+// yankPop replaces the text inserted by the previous yank with the next
+// older kill ring entry.
+func (e *Editor) yankPop() {
+	if e.lastCmd != cmdYank || len(e.r.killRing) == 0 {
+		return
+	}
+	e.c.input.delete(e.yankStart, e.c.cursor_x)
+	e.c.cursor_x = e.yankStart
+	e.yankIdx--
+	if e.yankIdx < 0 {
+		e.yankIdx = len(e.r.killRing) - 1
+	}
+	e.insertYank()
+}
+
+func (e *Editor) insertYank() {
+	for _, r := range e.r.killRing[e.yankIdx] {
+		e.c.input.insert(e.c.cursor_x, r)
+		e.c.cursor_x++
+	}
+	e.dirty = true
+	e.thisCmd = cmdYank
+}
@@ -0,0 +1,55 @@
+package rl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKillUnixWord(t *testing.T) {
+	e := &Editor{r: NewRl(), c: &ctx{input: newBuffer("abc def ghi"), cursor_x: 8}}
+	e.kill(e.c.input.wordStart(e.c.cursor_x), e.c.cursor_x, true)
+	if e.c.input.String() != "abc ghi" {
+		t.Fatalf("kill = %q, want %q", e.c.input.String(), "abc ghi")
+	}
+	if e.c.cursor_x != 4 {
+		t.Fatalf("kill cursor = %d, want 4", e.c.cursor_x)
+	}
+	if !reflect.DeepEqual(e.r.killRing, []string{"def "}) {
+		t.Fatalf("kill ring = %q, want %q", e.r.killRing, []string{"def "})
+	}
+}
+
+func TestConsecutiveKillsMerge(t *testing.T) {
+	e := &Editor{r: NewRl(), c: &ctx{input: newBuffer("one two three"), cursor_x: 8}}
+	e.kill(e.c.input.wordStart(e.c.cursor_x), e.c.cursor_x, true)
+	e.lastCmd, e.thisCmd = e.thisCmd, cmdOther
+	e.kill(e.c.input.wordStart(e.c.cursor_x), e.c.cursor_x, true)
+	e.lastCmd, e.thisCmd = e.thisCmd, cmdOther
+	e.kill(e.c.cursor_x, e.c.input.len(), false)
+
+	want := []string{"one two three"}
+	if !reflect.DeepEqual(e.r.killRing, want) {
+		t.Fatalf("kill ring = %q, want %q", e.r.killRing, want)
+	}
+}
+
+func TestYankPopRotates(t *testing.T) {
+	r := NewRl()
+	r.killRing = []string{"first", "second"}
+	e := &Editor{r: r, c: &ctx{input: newBuffer("<>"), cursor_x: 1}}
+
+	e.yank()
+	if e.c.input.String() != "<second>" {
+		t.Fatalf("yank = %q, want %q", e.c.input.String(), "<second>")
+	}
+	e.lastCmd, e.thisCmd = e.thisCmd, cmdOther
+	e.yankPop()
+	if e.c.input.String() != "<first>" || e.c.cursor_x != 6 {
+		t.Fatalf("yankPop = %q cursor %d, want %q cursor 6", e.c.input.String(), e.c.cursor_x, "<first>")
+	}
+	e.lastCmd, e.thisCmd = e.thisCmd, cmdOther
+	e.yankPop()
+	if e.c.input.String() != "<second>" {
+		t.Fatalf("second yankPop = %q, want %q", e.c.input.String(), "<second>")
+	}
+}
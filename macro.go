@@ -0,0 +1,34 @@
+package rl
+
+// startKbdMacro starts recording the keys typed, including those already
+// read but not yet handled.
+func startKbdMacro(e *Editor) {
+	e.r.recording = true
+	e.r.macroRec = append([]Key(nil), e.keys...)
+}
+
+// endKbdMacro stops recording and saves the keys typed since
+// start-kbd-macro, without the ones that invoked this command, as the
+// macro replayed by call-last-kbd-macro.
+func endKbdMacro(e *Editor) {
+	if !e.r.recording {
+		return
+	}
+	n := max(len(e.r.macroRec)-len(e.keys)-e.seqLen, 0)
+	e.r.kbdMacro = append([]Key(nil), e.r.macroRec[:n]...)
+	e.r.recording = false
+	e.r.macroRec = nil
+}
+
+// callLastKbdMacro replays the last macro, as many times as the numeric
+// argument says, by queueing its keys ahead of any typed ones.
+func callLastKbdMacro(e *Editor) {
+	if e.r.recording || len(e.r.kbdMacro) == 0 {
+		return
+	}
+	var ks []Key
+	for n := e.count(); n > 0; n-- {
+		ks = append(ks, e.r.kbdMacro...)
+	}
+	e.keys = append(ks, e.keys...)
+}
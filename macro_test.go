@@ -0,0 +1,36 @@
+package rl
+
+import "testing"
+
+func TestKbdMacro(t *testing.T) {
+	e := &Editor{r: NewRl(), c: &ctx{input: newBuffer("a"), cursor_x: 1}}
+	keys := []Key{ctrlKey('x'), {Rune: '('}, ctrlKey('a'), {Rune: '['}, ctrlKey('e'), {Rune: ']'}, ctrlKey('x'), {Rune: ')'}}
+	runKeys(e, keys...)
+	if e.c.input.String() != "[a]" {
+		t.Fatalf("recording = %q, want %q", e.c.input.String(), "[a]")
+	}
+	if len(e.r.kbdMacro) != 4 {
+		t.Fatalf("macro = %v, want 4 keys", e.r.kbdMacro)
+	}
+
+	runKeys(e, ctrlKey('x'), Key{Rune: 'e'})
+	if e.c.input.String() != "[[a]]" {
+		t.Fatalf("replay = %q, want %q", e.c.input.String(), "[[a]]")
+	}
+	runKeys(e, altKey('2'), ctrlKey('x'), Key{Rune: 'e'})
+	if e.c.input.String() != "[[[[a]]]]" {
+		t.Fatalf("replay twice = %q, want %q", e.c.input.String(), "[[[[a]]]]")
+	}
+}
+
+func TestKbdMacroKeptAcrossLines(t *testing.T) {
+	r := NewRl()
+	e := &Editor{r: r, c: &ctx{}}
+	runKeys(e, ctrlKey('x'), Key{Rune: '('}, Key{Rune: 'x'}, ctrlKey('x'), Key{Rune: ')'})
+
+	e = &Editor{r: r, c: &ctx{}}
+	runKeys(e, ctrlKey('x'), Key{Rune: 'e'})
+	if e.c.input.String() != "x" {
+		t.Fatalf("replay on the next line = %q, want %q", e.c.input.String(), "x")
+	}
+}
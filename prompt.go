@@ -0,0 +1,143 @@
+package rl
+
+import "strings"
+
+// promptPart is a run of the prompt that is either shown text or an
+// invisible span that takes no columns on the terminal.
+type promptPart struct {
+	s      string
+	hidden bool
+}
+
+// splitPrompt splits the prompt into shown text and invisible spans, so
+// that a colored prompt is measured by the text it shows. Escape sequences
+// (such as SGR colors, OSC 8 hyperlinks and OSC window titles) are
+// invisible, and so is any text between \x01 and \x02, as in readline.
+// The \x01 and \x02 markers themselves are dropped.
+func splitPrompt(p string) []promptPart {
+	var parts []promptPart
+	add := func(s string, hidden bool) {
+		if s == "" {
+			return
+		}
+		if n := len(parts); n > 0 && parts[n-1].hidden == hidden {
+			parts[n-1].s += s
+			return
+		}
+		parts = append(parts, promptPart{s: s, hidden: hidden})
+	}
+
+	for p != "" {
+		i := strings.IndexAny(p, "\x01\x1b")
+		if i < 0 {
+			add(p, false)
+			break
+		}
+		add(p[:i], false)
+		p = p[i:]
+
+		var n int
+		if p[0] == '\x01' {
+			end := strings.IndexByte(p, '\x02')
+			if end < 0 {
+				end = len(p)
+			}
+			add(p[1:end], true)
+			n = min(end+1, len(p))
+		} else {
+			n = escapeLen(p)
+			add(p[:n], true)
+		}
+		p = p[n:]
+	}
+	return parts
+}
+
+// visiblePrompt returns the prompt without its invisible spans, for
+// consoles that would show escape sequences as text.
+func visiblePrompt(p string) string {
+	var b strings.Builder
+	for _, part := range splitPrompt(p) {
+		if !part.hidden {
+			b.WriteString(part.s)
+		}
+	}
+	return b.String()
+}
+
+// escapeLen returns the length of the escape sequence at the start of s,
+// or of as much of it as s holds.
+func escapeLen(s string) int {
+	if len(s) < 2 {
+		return len(s)
+	}
+	switch s[1] {
+	case '[':
+		// CSI: parameters and intermediates up to a final byte.
+		for i := 2; i < len(s); i++ {
+			if s[i] >= 0x40 && s[i] <= 0x7e {
+				return i + 1
+			}
+		}
+	case ']', 'P', '_', '^':
+		// OSC, DCS, APC and PM strings end with BEL or ST (ESC \).
+		for i := 2; i < len(s); i++ {
+			if s[i] == '\a' {
+				return i + 1
+			}
+			if s[i] == '\x1b' && i+1 < len(s) && s[i+1] == '\\' {
+				return i + 2
+			}
+		}
+	default:
+		// Intermediates followed by a final byte, as in ESC ( B.
+		for i := 1; i < len(s); i++ {
+			if s[i] < 0x20 || s[i] > 0x2f {
+				return i + 1
+			}
+		}
+	}
+	return len(s)
+}
+
+// rightPromptCol returns the column at which to draw the right prompt rp
+// so that it ends at the right edge, or -1 if it does not fit beside the
+// width columns the line takes on its first row, with one column between.
+func rightPromptCol(rp string, width, size int) int {
+	rpw := 0
+	for _, cl := range lineCells(rp, nil) {
+		rpw += cl.width
+	}
+	if rp == "" || width+1+rpw > size {
+		return -1
+	}
+	return size - rpw
+}
+
+// splitPromptHead splits a multi-line prompt into the lines above the line
+// being edited, with their newlines, which are drawn once, and its last
+// line, which is redrawn with the text after it.
+func splitPromptHead(p string) (head, last string) {
+	i := strings.LastIndexByte(p, '\n')
+	return p[:i+1], p[i+1:]
+}
+
+// headRows returns the number of terminal rows that head takes on a
+// terminal size columns wide.
+func headRows(head string, size int) int {
+	rows := 0
+	for _, line := range strings.SplitAfter(head, "\n") {
+		if line == "" {
+			continue
+		}
+		width := 0
+		for _, cl := range lineCells(strings.TrimSuffix(line, "\n"), nil) {
+			width += cl.width
+		}
+		rows++
+		if size > 0 && width > size {
+			rows += (width - 1) / size
+		}
+	}
+	return rows
+}
@@ -0,0 +1,167 @@
+package rl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitPrompt(t *testing.T) {
+	tests := []struct {
+		prompt string
+		want   []promptPart
+	}{
+		{"> ", []promptPart{{s: "> "}}},
+		{
+			"\x1b[32m> \x1b[0m",
+			[]promptPart{{s: "\x1b[32m", hidden: true}, {s: "> "}, {s: "\x1b[0m", hidden: true}},
+		},
+		{
+			"\x1b]8;;http://example.com\x1b\\link\x1b]8;;\x1b\\$ ",
+			[]promptPart{{s: "\x1b]8;;http://example.com\x1b\\", hidden: true}, {s: "link"}, {s: "\x1b]8;;\x1b\\", hidden: true}, {s: "$ "}},
+		},
+		{
+			"\x1b]0;title\a\x1b(B$ ",
+			[]promptPart{{s: "\x1b]0;title\a\x1b(B", hidden: true}, {s: "$ "}},
+		},
+		{
+			"\x01\x1b[1m\x02bold\x01\x1b[0m\x02> ",
+			[]promptPart{{s: "\x1b[1m", hidden: true}, {s: "bold"}, {s: "\x1b[0m", hidden: true}, {s: "> "}},
+		},
+		{"a\x01open", []promptPart{{s: "a"}, {s: "open", hidden: true}}},
+		{"a\x1b[3", []promptPart{{s: "a"}, {s: "\x1b[3", hidden: true}}},
+	}
+
+	for _, tt := range tests {
+		if got := splitPrompt(tt.prompt); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitPrompt(%q) = %+v, want %+v", tt.prompt, got, tt.want)
+		}
+	}
+}
+
+func TestLineCellsColoredPrompt(t *testing.T) {
+	width := 0
+	for _, cl := range lineCells("\x1b[32m日本> \x1b[0m", []rune("ab")) {
+		width += cl.width
+	}
+	if width != 8 {
+		t.Fatalf("width = %d, want 8", width)
+	}
+}
+
+func TestSplitPromptHead(t *testing.T) {
+	tests := []struct {
+		prompt, head, last string
+	}{
+		{"> ", "", "> "},
+		{"\n> ", "\n", "> "},
+		{"main ✓\n~/src\n> ", "main ✓\n~/src\n", "> "},
+	}
+	for _, tt := range tests {
+		if head, last := splitPromptHead(tt.prompt); head != tt.head || last != tt.last {
+			t.Errorf("splitPromptHead(%q) = %q, %q, want %q, %q", tt.prompt, head, last, tt.head, tt.last)
+		}
+	}
+}
+
+func TestHeadRows(t *testing.T) {
+	tests := []struct {
+		head string
+		want int
+	}{
+		{"", 0},
+		{"\n", 1},
+		{"\x1b[1mstatus\x1b[0m\n\n", 2},
+		{"0123456789\n", 1},
+		{"0123456789a\n", 2},
+		{"日本語日本語\n", 2},
+	}
+	for _, tt := range tests {
+		if got := headRows(tt.head, 10); got != tt.want {
+			t.Errorf("headRows(%q, 10) = %d, want %d", tt.head, got, tt.want)
+		}
+	}
+}
+
+func TestMultiLinePrompt(t *testing.T) {
+	r := NewRl()
+	r.ShowModeInPrompt = true
+	e := &Editor{r: r, c: &ctx{}, prompt: "status\n> "}
+	e.updateMode()
+	if e.c.head != "status\n" || e.c.prompt != "@> " {
+		t.Fatalf("head %q prompt %q, want %q and %q", e.c.head, e.c.prompt, "status\n", "@> ")
+	}
+
+	e.c.head_drawn = true
+	e.SetPrompt("status\n$ ")
+	if !e.c.head_drawn || e.c.prompt != "@$ " {
+		t.Fatalf("changing the last line redrew the head or left prompt %q", e.c.prompt)
+	}
+	e.SetPrompt("other\n$ ")
+	if e.c.head_drawn || e.c.head != "other\n" {
+		t.Fatalf("changing the head left head %q drawn %v", e.c.head, e.c.head_drawn)
+	}
+}
+
+func TestRightPromptCol(t *testing.T) {
+	tests := []struct {
+		rp    string
+		width int
+		want  int
+	}{
+		{"", 0, -1},
+		{"ns:default", 5, 10},
+		{"\x1b[2m12:00\x1b[0m", 5, 15},
+		{"ns:default", 9, 10},
+		{"ns:default", 10, -1},
+		{"日本", 0, 16},
+	}
+	for _, tt := range tests {
+		if got := rightPromptCol(tt.rp, tt.width, 20); got != tt.want {
+			t.Errorf("rightPromptCol(%q, %d, 20) = %d, want %d", tt.rp, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestRightPromptFunc(t *testing.T) {
+	r := NewRl()
+	r.RightPrompt = "static"
+	e := &Editor{r: r, c: &ctx{}}
+	if got := e.rightPrompt(); got != "static" {
+		t.Fatalf("rightPrompt = %q, want %q", got, "static")
+	}
+	n := 0
+	r.RightPromptFunc = func() string {
+		n++
+		return "call"
+	}
+	if got := e.rightPrompt(); got != "call" || n != 1 {
+		t.Fatalf("rightPrompt = %q after %d calls, want %q after 1", got, n, "call")
+	}
+}
+
+func TestVisiblePrompt(t *testing.T) {
+	if got := visiblePrompt("\x1b[32m> \x1b[0m\x01hidden\x02$ "); got != "> $ " {
+		t.Fatalf("visiblePrompt = %q, want %q", got, "> $ ")
+	}
+}
+
+func TestPromptFunc(t *testing.T) {
+	r := NewRl()
+	prompt := "1> "
+	r.PromptFunc = func() string { return prompt }
+	e := &Editor{r: r, c: &ctx{}, prompt: r.Prompt}
+	e.updateMode()
+
+	e.updatePrompts()
+	if e.Prompt() != "1> " || e.c.prompt != "1> " || !e.dirty {
+		t.Fatalf("prompt %q shown %q dirty %v, want %q shown and dirty", e.Prompt(), e.c.prompt, e.dirty, "1> ")
+	}
+
+	// A temporary prompt, as for incremental search, is left alone.
+	e.c.prompt = "(reverse-i-search)`': "
+	prompt = "2> "
+	e.updatePrompts()
+	if e.Prompt() != "2> " || e.c.prompt != "(reverse-i-search)`': " {
+		t.Fatalf("prompt %q shown %q, want %q with the search prompt shown", e.Prompt(), e.c.prompt, "2> ")
+	}
+}
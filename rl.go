@@ -4,17 +4,119 @@ import (
 	"io"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
+	"unicode"
 )
 
+// ShellWordChars makes the Alt word commands treat the punctuation common
+// in shell arguments and paths as part of words, like zsh's WORDCHARS.
+const ShellWordChars = "*?_-.[]~=/&;!#$%^(){}<>"
+
 type Rl struct {
 	Prompt       string
 	PasswordRune rune
 	EOFOnCtrlD   bool
 	CompleteFunc func(string, int) (int, []string)
+
+	// PromptFunc, when set, is called for the prompt on every redraw
+	// instead of using Prompt, so that the prompt can change while a line
+	// is typed. Call Refresh to redraw when it would change.
+	PromptFunc func() string
+
+	// HistoryFile, when set, is loaded before the first line is read and
+	// every line added to the history is appended to it.
+	HistoryFile string
+	// HistorySize limits the number of history entries kept in memory and
+	// in HistoryFile. Zero means no limit.
+	HistorySize int
+	// HistorySearchPrefix makes previous-history and next-history (Up and
+	// Down) only visit history entries starting with the text before the
+	// cursor.
+	HistorySearchPrefix bool
+	// WordChars lists the characters besides letters and digits that Alt-B,
+	// Alt-F, Alt-D and Alt-Backspace consider part of a word.
+	WordChars string
+	// Keymap holds the key bindings. NewRl sets it to EmacsKeymap(), which
+	// is also used when it is nil.
+	Keymap *Keymap
+	// Mode selects emacs or vi style editing.
+	Mode EditMode
+	// ViInsertKeymap and ViCommandKeymap hold the key bindings of vi insert
+	// and command mode. NewRl sets them to ViInsertKeymap() and
+	// ViCommandKeymap(), which are also used when they are nil.
+	ViInsertKeymap  *Keymap
+	ViCommandKeymap *Keymap
+	// KeyseqTimeout is how long to wait for the rest of a key sequence
+	// that starts with a character typed into the line, like jk bound in
+	// vi insert mode. The character is typed as usual when nothing
+	// follows in time. Zero waits as long as it takes. NewRl sets it to
+	// 500ms, as in readline.
+	KeyseqTimeout time.Duration
+
+	// ShowModeInPrompt puts EmacsModeString, ViInsModeString or
+	// ViCmdModeString, depending on the editing mode, before the prompt.
+	ShowModeInPrompt bool
+	EmacsModeString  string
+	ViInsModeString  string
+	ViCmdModeString  string
+	// ViCursorShape shows the vi mode through the cursor instead: a bar in
+	// insert mode and a block in command mode.
+	ViCursorShape bool
+
+	// RightPrompt is shown flush right on the first row of the line, like
+	// zsh's RPROMPT, unless the text would run into it. RightPromptFunc,
+	// when set, is called for it on every redraw instead, so it can show
+	// a clock or other changing state.
+	RightPrompt     string
+	RightPromptFunc func() string
+	// TransientRightPrompt removes the right prompt from the screen when
+	// the line is accepted.
+	TransientRightPrompt bool
+
+	// BracketedPaste asks the terminal to mark pasted text so that it is
+	// inserted as it is instead of running the commands bound to tabs and
+	// newlines in it. NewRl enables it.
+	BracketedPaste bool
+	// PasteNewline, when not empty, replaces the line breaks in pasted
+	// text. Otherwise they are kept as "\n" in the line.
+	PasteNewline string
+	// CompletionIgnoreCase makes completion ignore case when finding the
+	// common prefix of the candidates.
+	CompletionIgnoreCase bool
+
+	// AppName is matched by "$if name" lines in init files.
+	AppName string
+	// WarningFunc, when set, receives problems found while reading init
+	// files, such as unsupported directives, that do not stop the rest of
+	// the file from being applied.
+	WarningFunc func(error)
+
+	history       []string
+	historyLoaded bool
+	lastSearch    string
+	killRing      []string
+	heldLine      string
+	initFile      string
+	// typeahead holds the keys read after the last line was accepted, and
+	// pendingInput the start of a key not yet complete, for the next line.
+	typeahead    []Key
+	pendingInput []byte
+
+	// kbdMacro is the last keyboard macro. While recording is set the keys
+	// typed are collected in macroRec.
+	kbdMacro  []Key
+	macroRec  []Key
+	recording bool
+
+	// mu guards active, the ctx of the line being read, for Refresh.
+	mu     sync.Mutex
+	active *ctx
 }
 
-func commonPrefix(words []string) string {
+func commonPrefix(words []string, ignoreCase bool) string {
 	if len(words) == 0 {
 		return ""
 	}
@@ -28,7 +130,7 @@ func commonPrefix(words []string) string {
 		}
 
 		i := 0
-		for i < n && prefix[i] == rs[i] {
+		for i < n && (prefix[i] == rs[i] || ignoreCase && unicode.ToLower(prefix[i]) == unicode.ToLower(rs[i])) {
 			i++
 		}
 		prefix = prefix[:i]
@@ -41,74 +143,160 @@ func commonPrefix(words []string) string {
 }
 
 func NewRl() *Rl {
-	return &Rl{Prompt: "> ", PasswordRune: '*'}
+	return &Rl{
+		Prompt:          "> ",
+		PasswordRune:    '*',
+		HistorySize:     1000,
+		BracketedPaste:  true,
+		Keymap:          EmacsKeymap(),
+		ViInsertKeymap:  ViInsertKeymap(),
+		ViCommandKeymap: ViCommandKeymap(),
+		KeyseqTimeout:   500 * time.Millisecond,
+		EmacsModeString: "@",
+		ViInsModeString: "(ins)",
+		ViCmdModeString: "(cmd)",
+	}
 }
 
 func shouldReturnEOFOnCtrlD(input []rune, eofOnCtrlD bool) bool {
 	return eofOnCtrlD || len(input) == 0
 }
 
-func applyCompletion(input []rune, completePos, cursor int, candidates []string) ([]rune, int, bool) {
-	if len(candidates) == 0 || completePos < 0 || completePos > cursor || cursor > len(input) {
-		return input, 0, false
-	}
+func isWordRune(r rune, wordChars string) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(wordChars, r)
+}
 
-	item := commonPrefix(candidates)
-	if item == "" {
-		return input, 0, false
+// forwardWord returns the position just past the end of the word at or
+// after cursor. Words are made of grapheme clusters whose first rune is a
+// word rune, so a letter keeps its combining marks.
+func forwardWord(input []rune, cursor int, wordChars string) int {
+	t := runeSlice(input)
+	for cursor < len(input) && !isWordRune(input[cursor], wordChars) {
+		cursor = nextGrapheme(t, cursor)
 	}
-
-	tmp := make([]rune, 0, completePos+len([]rune(item))+len(input)-cursor)
-	tmp = append(tmp, input[:completePos]...)
-	tmp = append(tmp, []rune(item)...)
-	tmp = append(tmp, input[cursor:]...)
-	return tmp, completePos + len([]rune(item)), true
+	for cursor < len(input) && isWordRune(input[cursor], wordChars) {
+		cursor = nextGrapheme(t, cursor)
+	}
+	return cursor
 }
 
-func deleteWordBeforeCursor(input []rune, cursor int) ([]rune, int, bool) {
-	if cursor <= 0 || cursor > len(input) {
-		return input, cursor, false
+// backwardWord returns the start of the word before cursor.
+func backwardWord(input []rune, cursor int, wordChars string) int {
+	t := runeSlice(input)
+	for cursor > 0 {
+		prev := prevGrapheme(t, cursor)
+		if isWordRune(input[prev], wordChars) {
+			break
+		}
+		cursor = prev
 	}
-
-	start := cursor
-	for start > 0 && (input[start-1] == ' ' || input[start-1] == '\t') {
-		start--
+	for cursor > 0 {
+		prev := prevGrapheme(t, cursor)
+		if !isWordRune(input[prev], wordChars) {
+			break
+		}
+		cursor = prev
 	}
-	for start > 0 && input[start-1] != ' ' && input[start-1] != '\t' {
-		start--
+	return cursor
+}
+
+// transposeWords swaps the word before the cursor with the word after it.
+// It returns where the first word starts and the text from there to the
+// end of the second with the words swapped, after which the cursor goes.
+// At the end of the line the last two words are swapped.
+func transposeWords(input []rune, cursor int, wordChars string) (int, []rune, bool) {
+	end2 := forwardWord(input, cursor, wordChars)
+	beg2 := backwardWord(input, end2, wordChars)
+	beg1 := backwardWord(input, beg2, wordChars)
+	end1 := forwardWord(input, beg1, wordChars)
+	if beg1 == beg2 || end1 > beg2 {
+		return cursor, nil, false
 	}
-	if start == cursor {
-		return input, cursor, false
+
+	out := make([]rune, 0, end2-beg1)
+	out = append(out, input[beg2:end2]...)
+	out = append(out, input[end1:beg2]...)
+	out = append(out, input[beg1:end1]...)
+	return beg1, out, true
+}
+
+// changeWordCase returns the runes from the cursor to the end of the word
+// mapped through conv, which is given each rune and whether it starts the
+// word. Runes are converted one by one so the length of the line does not
+// change.
+func changeWordCase(input []rune, cursor int, wordChars string, conv func(r rune, first bool) rune) []rune {
+	end := forwardWord(input, cursor, wordChars)
+	out := append([]rune(nil), input[cursor:end]...)
+	first := true
+	for i, r := range out {
+		if !isWordRune(r, wordChars) {
+			continue
+		}
+		out[i] = conv(r, first)
+		first = false
 	}
+	return out
+}
+
+func upcaseRune(r rune, first bool) rune {
+	return unicode.ToUpper(r)
+}
 
-	out := append(input[:start], input[cursor:]...)
-	return out, start, true
+func downcaseRune(r rune, first bool) rune {
+	return unicode.ToLower(r)
 }
 
-func insertRune(input []rune, cursor int, r rune) ([]rune, int) {
-	tmp := make([]rune, 0, len(input)+1)
-	tmp = append(tmp, input[:cursor]...)
-	tmp = append(tmp, r)
-	tmp = append(tmp, input[cursor:]...)
-	return tmp, cursor + 1
+func capitalizeRune(r rune, first bool) rune {
+	if first {
+		return unicode.ToTitle(r)
+	}
+	return unicode.ToLower(r)
 }
 
-func deleteRuneBeforeCursor(input []rune, cursor int) ([]rune, int, bool) {
-	if cursor <= 0 || cursor > len(input) {
-		return input, cursor, false
+// displayRune returns how r is drawn in the line: control characters in
+// caret notation, such as "^I" for a tab, and anything else as itself.
+func displayRune(r rune) string {
+	switch {
+	case r < 0x20:
+		return string([]rune{'^', r + '@'})
+	case r == 0x7f:
+		return "^?"
 	}
+	return string(r)
+}
 
-	out := append(input[:cursor-1], input[cursor:]...)
-	return out, cursor - 1, true
+// isSelfInsert reports whether k types a character into the line.
+func isSelfInsert(k Key) bool {
+	return k.Code == KeyRune && !k.Ctrl && !k.Alt
 }
 
 func (r *Rl) readLine(passwordInput bool) (string, error) {
+	if err := r.loadHistoryFile(); err != nil {
+		return "", err
+	}
+
 	c, err := newCtx(r.Prompt)
 	if err != nil {
 		return "", err
 	}
 	defer c.tearDown()
+	r.mu.Lock()
+	r.active = c
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.active = nil
+		r.mu.Unlock()
+	}()
+	if r.BracketedPaste {
+		c.enableBracketedPaste()
+	}
+	return r.edit(c, passwordInput)
+}
 
+// edit reads a line from c, starting with the keys left over from the
+// last line.
+func (r *Rl) edit(c *ctx, passwordInput bool) (string, error) {
 	var quit int32
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, os.Interrupt)
@@ -123,92 +311,91 @@ func (r *Rl) readLine(passwordInput bool) (string, error) {
 		}
 	}()
 
-	passwordRune := rune(0)
+	e := &Editor{r: r, c: c, dirty: true, histIdx: len(r.history), prompt: r.Prompt}
+	e.keys, r.typeahead = r.typeahead, nil
+	c.setPendingInput(r.pendingInput)
+	r.pendingInput = nil
+	defer func() {
+		// Keys typed or pasted ahead of the next prompt were read along
+		// with this line.
+		r.typeahead = e.keys
+		r.pendingInput = c.pendingInput()
+	}()
+	defer func() {
+		if e.shape != cursorDefault {
+			c.setCursorShape(cursorDefault)
+		}
+	}()
 	if passwordInput {
-		passwordRune = r.PasswordRune
+		e.password = true
+		e.passwordRune = r.PasswordRune
+	}
+	if r.heldLine != "" {
+		e.SetLine(r.heldLine)
+		e.resetUndo()
+		r.heldLine = ""
 	}
 
-	dirty := true
-loop:
-	for atomic.LoadInt32(&quit) == 0 {
-		if err := c.redraw(dirty, passwordRune); err != nil {
-			return "", err
-		}
-		dirty = false
+	r.initKeymaps()
+	e.updateMode()
 
-		rs, err := c.readRunes()
+	for atomic.LoadInt32(&quit) == 0 && e.state == stateEditing {
+		k, err := e.readKey()
 		if err != nil {
 			break
 		}
-		for _, rc := range rs {
-			switch rc {
-			case 0:
-			case 1: // CTRL-A
-				c.cursor_x = 0
-			case 2: // CTRL-B
-				if c.cursor_x > 0 {
-					c.cursor_x--
-				}
-			case 3: // BREAK
-				return "", nil
-			case 4: // CTRL-D
-				if !shouldReturnEOFOnCtrlD(c.input, r.EOFOnCtrlD) {
-					continue
-				}
-				return "", io.EOF
-			case 5: // CTRL-E
-				c.cursor_x = len(c.input)
-			case 6: // CTRL-F
-				if c.cursor_x < len(c.input) {
-					c.cursor_x++
-				}
-			case 8, 0x7F: // BS
-				var ok bool
-				c.input, c.cursor_x, ok = deleteRuneBeforeCursor(c.input, c.cursor_x)
-				if ok {
-					dirty = true
-				}
-			case 9: // TAB
-				if r.CompleteFunc == nil {
-					continue
-				}
-				completePos, candidates := r.CompleteFunc(string(c.input), c.cursor_x)
-				var ok bool
-				c.input, c.cursor_x, ok = applyCompletion(c.input, completePos, c.cursor_x, candidates)
-				if ok {
-					dirty = true
-				}
-			case 10: // LF
-				break loop
-			case 11: // CTRL-K
-				c.input = c.input[:c.cursor_x]
-				dirty = true
-			case 12: // CTRL-L
-				dirty = true
-			case 13: // CR
-				break loop
-			case 21: // CTRL-U
-				c.input = c.input[c.cursor_x:]
-				c.cursor_x = 0
-				dirty = true
-			case 23: // CTRL-W
-				var ok bool
-				c.input, c.cursor_x, ok = deleteWordBeforeCursor(c.input, c.cursor_x)
-				if ok {
-					dirty = true
-				}
-			default:
-				c.input, c.cursor_x = insertRune(c.input, c.cursor_x, rc)
-				dirty = true
-			}
+		e.handleKey(k)
+		if e.readErr != nil {
+			break
 		}
 	}
 
+	switch e.state {
+	case stateInterrupted:
+		return "", nil
+	case stateEOF:
+		return "", io.EOF
+	}
+
+	if r.TransientRightPrompt && c.rprompt != "" {
+		c.rprompt = ""
+		e.dirty = true
+	}
+	// Keys handled while more input was waiting have not been drawn.
+	c.redraw(e.dirty, e.passwordRune)
 	os.Stdout.WriteString("\n")
 	if atomic.LoadInt32(&quit) != 0 {
 		return "", nil
 	}
-	return string(c.input), nil
+	line := c.input.String()
+	if !passwordInput {
+		r.AddHistory(line)
+	}
+	return line, nil
+}
+
+// Refresh redraws the line being read, calling PromptFunc and
+// RightPromptFunc again. It may be called from any goroutine, and does
+// nothing when no line is being read.
+func (r *Rl) Refresh() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.active != nil {
+		r.active.wake()
+	}
+}
+
+// initKeymaps fills in the keymaps left nil with the defaults.
+func (r *Rl) initKeymaps() {
+	if r.Keymap == nil {
+		r.Keymap = EmacsKeymap()
+	}
+	if r.ViInsertKeymap == nil {
+		r.ViInsertKeymap = ViInsertKeymap()
+	}
+	if r.ViCommandKeymap == nil {
+		r.ViCommandKeymap = ViCommandKeymap()
+	}
 }
 
 func (r *Rl) ReadLine() (string, error) {
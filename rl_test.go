@@ -1,6 +1,10 @@
 package rl
 
-import "testing"
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
 
 func TestShouldReturnEOFOnCtrlD(t *testing.T) {
 	tests := []struct {
@@ -37,38 +41,166 @@ func TestShouldReturnEOFOnCtrlD(t *testing.T) {
 	}
 }
 
-func TestApplyCompletionPreservesSuffix(t *testing.T) {
-	got, cursor, ok := applyCompletion([]rune("say he world"), 4, 6, []string{"hello", "help"})
-	if !ok {
-		t.Fatal("applyCompletion returned !ok")
+func TestWordMotion(t *testing.T) {
+	input := []rune("cd /usr/local-bin; ls")
+	tests := []struct {
+		name      string
+		wordChars string
+		cursor    int
+		forward   int
+		backward  int
+	}{
+		{name: "alphanumeric words", cursor: 8, forward: 13, backward: 4},
+		{name: "shell words", wordChars: ShellWordChars, cursor: 8, forward: 18, backward: 3},
+		{name: "end of line", cursor: 21, forward: 21, backward: 19},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := forwardWord(input, tt.cursor, tt.wordChars); got != tt.forward {
+				t.Fatalf("forwardWord(%d) = %d, want %d", tt.cursor, got, tt.forward)
+			}
+			if got := backwardWord(input, tt.cursor, tt.wordChars); got != tt.backward {
+				t.Fatalf("backwardWord(%d) = %d, want %d", tt.cursor, got, tt.backward)
+			}
+		})
+	}
+}
+
+func TestWordMotionUnicode(t *testing.T) {
+	input := []rune("héllo wörld")
+	if got := forwardWord(input, 0, ""); got != 5 {
+		t.Fatalf("forwardWord = %d, want 5", got)
+	}
+	if got := backwardWord(input, len(input), ""); got != 6 {
+		t.Fatalf("backwardWord = %d, want 6", got)
 	}
-	if string(got) != "say hel world" {
-		t.Fatalf("applyCompletion = %q, want %q", string(got), "say hel world")
+}
+
+func TestTransposeWords(t *testing.T) {
+	start, got, ok := transposeWords([]rune("say one two, three"), 9, "")
+	if !ok || start != 4 || string(got) != "two one" {
+		t.Fatalf("transposeWords = %d, %q, %v, want 4, %q, true", start, string(got), ok, "two one")
 	}
-	if cursor != 7 {
-		t.Fatalf("applyCompletion cursor = %d, want 7", cursor)
+	start, got, ok = transposeWords([]rune("one two"), 7, "")
+	if !ok || start != 0 || string(got) != "two one" {
+		t.Fatalf("transposeWords at end = %d, %q, %v, want 0, %q, true", start, string(got), ok, "two one")
 	}
 }
 
-func TestApplyCompletionHandlesUTF8Prefix(t *testing.T) {
-	got, _, ok := applyCompletion([]rune("こん"), 0, 2, []string{"こんにちは", "こんばんは"})
-	if !ok {
-		t.Fatal("applyCompletion returned !ok")
+func TestChangeWordCase(t *testing.T) {
+	tests := []struct {
+		conv func(rune, bool) rune
+		want string
+	}{
+		{upcaseRune, " ÉLAN"},
+		{downcaseRune, " élan"},
+		{capitalizeRune, " Élan"},
 	}
-	if string(got) != "こん" {
-		t.Fatalf("applyCompletion = %q, want %q", string(got), "こん")
+
+	for _, tt := range tests {
+		got := changeWordCase([]rune("say éLaN now"), 3, "", tt.conv)
+		if string(got) != tt.want {
+			t.Fatalf("changeWordCase = %q, want %q", string(got), tt.want)
+		}
 	}
 }
 
-func TestDeleteWordBeforeCursor(t *testing.T) {
-	got, cursor, ok := deleteWordBeforeCursor([]rune("abc def ghi"), 8)
-	if !ok {
-		t.Fatal("deleteWordBeforeCursor returned !ok")
+func TestQuotedInsert(t *testing.T) {
+	e := &Editor{r: NewRl(), c: &ctx{input: newBuffer("ab"), cursor_x: 1}}
+	runKeys(e, ctrlKey('v'), Key{Code: KeyTab}, ctrlKey('v'), ctrlKey('c'), ctrlKey('v'), ctrlKey('j'))
+	if e.c.input.String() != "a\t\x03\nb" || e.c.cursor_x != 4 || e.state != stateEditing {
+		t.Fatalf("got %q cursor %d state %d, want %q cursor 4", e.c.input.String(), e.c.cursor_x, e.state, "a\t\x03\nb")
 	}
-	if string(got) != "abc ghi" {
-		t.Fatalf("deleteWordBeforeCursor = %q, want %q", string(got), "abc ghi")
+}
+
+func TestDisplayRune(t *testing.T) {
+	for r, want := range map[rune]string{'\t': "^I", 0: "^@", 0x1b: "^[", 0x7f: "^?", 'a': "a", 'あ': "あ"} {
+		if got := displayRune(r); got != want {
+			t.Errorf("displayRune(%q) = %q, want %q", r, got, want)
+		}
 	}
-	if cursor != 4 {
-		t.Fatalf("deleteWordBeforeCursor cursor = %d, want 4", cursor)
+}
+
+func TestBracketedPaste(t *testing.T) {
+	paste := append([]Key{{Code: KeyPasteStart}}, typeKeys("if x {")...)
+	paste = append(paste, Key{Code: KeyEnter}, ctrlKey('j'), Key{Code: KeyTab}, Key{Rune: 'y'}, Key{Code: KeyEnter}, Key{Code: KeyPasteEnd})
+
+	e := &Editor{r: NewRl(), c: &ctx{}}
+	e.r.CompleteFunc = func(string, int) (int, []string) {
+		t.Fatal("completion ran on a pasted tab")
+		return 0, nil
+	}
+	runKeys(e, paste...)
+	if e.c.input.String() != "if x {\n\ty\n" || e.state != stateEditing {
+		t.Fatalf("paste = %q state %d, want %q still editing", e.c.input.String(), e.state, "if x {\n\ty\n")
+	}
+
+	e = &Editor{r: NewRl(), c: &ctx{}}
+	e.r.PasteNewline = "; "
+	runKeys(e, paste...)
+	if e.c.input.String() != "if x {; \ty; " {
+		t.Fatalf("paste with PasteNewline = %q, want %q", e.c.input.String(), "if x {; \ty; ")
+	}
+}
+
+// BenchmarkPaste measures inserting a 50 KB paste, with and without
+// bracketed paste.
+func BenchmarkPaste(b *testing.B) {
+	text := strings.Repeat(`{"id": 12345, "tags": ["a", "b"]}, `, 1500)
+	keys := typeKeys(text)
+	bracketed := append(append([]Key{{Code: KeyPasteStart}}, keys...), Key{Code: KeyPasteEnd})
+
+	for _, bm := range []struct {
+		name string
+		keys []Key
+	}{
+		{"plain", keys},
+		{"bracketed", bracketed},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.SetBytes(int64(len(text)))
+			for i := 0; i < b.N; i++ {
+				e := &Editor{r: NewRl(), c: &ctx{}}
+				runKeys(e, bm.keys...)
+				if e.c.input.len() != len(text) {
+					b.Fatalf("inserted %d runes, want %d", e.c.input.len(), len(text))
+				}
+			}
+		})
+	}
+
+	// Handling the keys one at a time, as when each arrives in its own
+	// read, is how pastes were inserted before they were batched.
+	b.Run("unbatched", func(b *testing.B) {
+		b.SetBytes(int64(len(text)))
+		for i := 0; i < b.N; i++ {
+			e := &Editor{r: NewRl(), c: &ctx{}}
+			for _, k := range keys {
+				e.handleKey(k)
+			}
+			if e.c.input.len() != len(text) {
+				b.Fatalf("inserted %d runes, want %d", e.c.input.len(), len(text))
+			}
+		}
+	})
+}
+
+// BenchmarkEditMiddle types and deletes single keys in the middle of a long
+// line, the cost paid for every key once a large paste is in the line.
+func BenchmarkEditMiddle(b *testing.B) {
+	for _, n := range []int{5000, 50000, 200000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			e := &Editor{r: NewRl(), c: &ctx{input: newBuffer(strings.Repeat("x", n)), cursor_x: n / 2}}
+			for i := 0; i < b.N; i++ {
+				e.handleKey(Key{Rune: 'a'})
+				e.handleKey(Key{Code: KeyBackspace})
+				e.handleKey(ctrlKey('b'))
+				e.handleKey(ctrlKey('f'))
+			}
+			if e.c.input.len() != n {
+				b.Fatalf("line has %d runes, want %d", e.c.input.len(), n)
+			}
+		})
 	}
 }
@@ -8,9 +8,8 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"unicode/utf8"
+	"strings"
 
-	"github.com/mattn/go-runewidth"
 	"golang.org/x/sys/unix"
 )
 
@@ -18,7 +17,7 @@ type ctx struct {
 	in       uintptr
 	out      uintptr
 	st       unix.Termios
-	input    []rune
+	input    buffer
 	last     []rune
 	prompt   string
 	cursor_x int
@@ -26,46 +25,148 @@ type ctx struct {
 	old_crow int
 	size     int
 	pending  []byte
+	// paste is set while bracketed paste mode is enabled.
+	paste bool
+	// hl_start and hl_end delimit a range of input shown highlighted.
+	hl_start int
+	hl_end   int
+	// head holds the lines of a multi-line prompt above the line. They are
+	// drawn once, taking head_rows rows, until head_drawn is cleared.
+	head       string
+	head_rows  int
+	head_drawn bool
+	// clear asks the next redraw to clear the screen first.
+	clear bool
+	// rprompt is the right prompt.
+	rprompt string
+	// wake_r and wake_w are a pipe written to by wake to interrupt
+	// readKeys, which then sets refresh.
+	wake_r  int
+	wake_w  int
+	refresh bool
 }
 
-func (c *ctx) readRunes() ([]rune, error) {
-	var buf [16]byte
+// escTimeout is how long, in milliseconds, to wait for the rest of an
+// escape sequence before treating ESC as a key press of its own.
+const escTimeout = 50
+
+func (c *ctx) readKeys() ([]Key, error) {
+	if len(c.pending) > 0 && c.pending[0] == 0x1b {
+		ready, err := c.waitInput(escTimeout)
+		if err != nil {
+			return nil, err
+		}
+		if !ready {
+			ks, pending := decodeKeys(c.pending, true)
+			c.pending = pending
+			return ks, nil
+		}
+	}
+
+	if woken, err := c.waitWake(); err != nil {
+		return nil, err
+	} else if woken {
+		return []Key{}, nil
+	}
+
+	var buf [4096]byte
 	n, err := unix.Read(int(c.in), buf[:])
 	if err != nil {
 		return nil, err
 	}
 	if n == 0 {
-		return []rune{}, nil
+		return []Key{}, nil
 	}
 
-	rs, pending := decodeRunes(append(c.pending, buf[:n]...))
+	ks, pending := decodeKeys(append(c.pending, buf[:n]...), false)
 	c.pending = pending
-	return rs, nil
+	return ks, nil
 }
 
-func decodeRunes(buf []byte) ([]rune, []byte) {
-	if len(buf) == 0 {
-		return []rune{}, nil
-	}
+// pendingInput returns the start of a key read but not yet decoded.
+func (c *ctx) pendingInput() []byte {
+	return c.pending
+}
 
-	var rs []rune
-	i := 0
-	for i < len(buf) {
-		if buf[i] == '\n' {
-			i++
+// setPendingInput makes b the start of the next key decoded.
+func (c *ctx) setPendingInput(b []byte) {
+	c.pending = b
+}
+
+// inputReady reports whether input is waiting to be read.
+func (c *ctx) inputReady() bool {
+	ready, _ := c.waitInput(0)
+	return ready
+}
+
+// waitWake waits for input or a call to wake, and reports whether it was
+// woken with no input waiting.
+func (c *ctx) waitWake() (bool, error) {
+	fds := []unix.PollFd{
+		{Fd: int32(c.in), Events: unix.POLLIN},
+		{Fd: int32(c.wake_r), Events: unix.POLLIN},
+	}
+	for {
+		_, err := unix.Poll(fds, -1)
+		if err == unix.EINTR {
 			continue
 		}
-		r, size := utf8.DecodeRune(buf[i:])
-		if r == utf8.RuneError && size == 1 {
-			if !utf8.FullRune(buf[i:]) {
-				return rs, append([]byte(nil), buf[i:]...)
-			}
+		if err != nil {
+			return false, err
+		}
+		break
+	}
+	if fds[1].Revents == 0 {
+		return false, nil
+	}
+	var buf [64]byte
+	for {
+		if n, _ := unix.Read(c.wake_r, buf[:]); n < len(buf) {
+			break
 		}
-		rs = append(rs, r)
-		i += size
 	}
+	c.refresh = true
+	return fds[0].Revents == 0, nil
+}
 
-	return rs, nil
+// openWake creates the pipe used by wake.
+func (c *ctx) openWake() error {
+	var p [2]int
+	if err := unix.Pipe(p[:]); err != nil {
+		return err
+	}
+	for _, fd := range p {
+		unix.CloseOnExec(fd)
+		if err := unix.SetNonblock(fd, true); err != nil {
+			unix.Close(p[0])
+			unix.Close(p[1])
+			return err
+		}
+	}
+	c.wake_r, c.wake_w = p[0], p[1]
+	return nil
+}
+
+// wake makes a blocked readKeys return so that the line is redrawn. It may
+// be called from another goroutine.
+func (c *ctx) wake() {
+	// A full pipe already holds a pending wake.
+	unix.Write(c.wake_w, []byte{0})
+}
+
+// waitInput reports whether input arrives within timeout milliseconds.
+func (c *ctx) waitInput(timeout int) (bool, error) {
+	fds := []unix.PollFd{{Fd: int32(c.in), Events: unix.POLLIN}}
+	for {
+		n, err := unix.Poll(fds, timeout)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		return n > 0, nil
+	}
 }
 
 func ioctlGetTermios(fd uintptr, req uint, st *unix.Termios) error {
@@ -100,25 +201,51 @@ func newCtx(prompt string) (*ctx, error) {
 	}
 
 	c.prompt = prompt
-	c.input = []rune{}
+	c.input = newBuffer("")
 
 	ws, err := unix.IoctlGetWinsize(int(c.in), unix.TIOCGWINSZ)
 	if err != nil {
 		return nil, err
 	}
 	c.size = int(ws.Col)
+	if err := c.openWake(); err != nil {
+		ioctlSetTermios(c.in, uint(TCSETS), &c.st)
+		return nil, err
+	}
 	return c, nil
 }
 
 func (c *ctx) tearDown() {
+	unix.Close(c.wake_r)
+	unix.Close(c.wake_w)
+	if c.paste {
+		os.Stdout.WriteString("\x1b[?2004l")
+	}
 	ioctlSetTermios(c.in, uint(TCSETS), &c.st)
 }
 
+// enableBracketedPaste makes the terminal mark pasted text with
+// ESC [ 200 ~ and ESC [ 201 ~.
+func (c *ctx) enableBracketedPaste() {
+	os.Stdout.WriteString("\x1b[?2004h")
+	c.paste = true
+}
+
 func (c *ctx) redraw(dirty bool, passwordChar rune) error {
 	var buf bytes.Buffer
 
 	//buf.WriteString("\x1b[>5h")
 
+	if c.clear {
+		buf.WriteString("\x1b[H\x1b[2J")
+		c.old_row, c.old_crow, c.head_rows = 0, 0, 0
+		c.head_drawn = false
+		c.clear = false
+	}
+	if !c.head_drawn {
+		dirty = true
+	}
+
 	buf.WriteString("\x1b[0G")
 	if dirty {
 		buf.WriteString("\x1b[0K")
@@ -132,25 +259,43 @@ func (c *ctx) redraw(dirty bool, passwordChar rune) error {
 		}
 		buf.WriteString("\x1b[A")
 	}
+	if dirty {
+		// The first row may hold the end of a longer prompt.
+		buf.WriteString("\x1b[2K")
+	}
+	if !c.head_drawn {
+		// Replace the lines above the prompt, which are otherwise left
+		// alone.
+		for i := 0; i < c.head_rows; i++ {
+			buf.WriteString("\x1b[A")
+		}
+		buf.WriteString("\x1b[J")
+		buf.WriteString(strings.ReplaceAll(c.head, "\n", "\r\n"))
+		c.head_rows = headRows(c.head, c.size)
+		c.head_drawn = true
+	}
 
 	var rs []rune
 	if passwordChar != 0 {
-		for i := 0; i < len(c.input); i++ {
+		for i := 0; i < c.input.len(); i++ {
 			rs = append(rs, passwordChar)
 		}
 	} else {
-		rs = c.input
+		// Copy the line rather than moving the gap away from the cursor.
+		rs = c.input.slice(0, c.input.len())
 	}
 
 	ccol, crow, col, row := -1, 0, 0, 0
-	plen := len([]rune(c.prompt))
-	for i, r := range []rune(c.prompt + string(rs)) {
-		if i == plen+c.cursor_x {
+	width := -1 // of the first row
+	for _, cl := range lineCells(c.prompt, rs) {
+		if cl.pos >= 0 && ccol == -1 && c.cursor_x < cl.pos+cl.n {
 			ccol = col
 			crow = row
 		}
-		rw := runewidth.RuneWidth(r)
-		if col+rw > c.size {
+		if col+cl.width > c.size {
+			if row == 0 {
+				width = col
+			}
 			col = 0
 			row++
 			if dirty {
@@ -158,15 +303,26 @@ func (c *ctx) redraw(dirty bool, passwordChar rune) error {
 			}
 		}
 		if dirty {
-			buf.WriteString(string(r))
+			if cl.pos >= c.hl_start && cl.pos < c.hl_end {
+				buf.WriteString("\x1b[7m" + cl.s + "\x1b[27m")
+			} else {
+				buf.WriteString(cl.s)
+			}
 		}
-		col += rw
+		col += cl.width
 	}
 	if dirty {
 		buf.WriteString("\x1b[0G")
 		for i := 0; i < row; i++ {
 			buf.WriteString("\x1b[A")
 		}
+		if width == -1 {
+			width = col
+		}
+		if rcol := rightPromptCol(c.rprompt, width, c.size); rcol >= 0 {
+			buf.WriteString(fmt.Sprintf("\x1b[%dG", rcol+1))
+			buf.WriteString(c.rprompt)
+		}
 	}
 	if ccol == -1 {
 		ccol = col
@@ -186,3 +342,32 @@ func (c *ctx) redraw(dirty bool, passwordChar rune) error {
 
 	return nil
 }
+
+// setCursorShape changes the cursor with DECSCUSR.
+func (c *ctx) setCursorShape(shape cursorShape) {
+	switch shape {
+	case cursorBar:
+		os.Stdout.WriteString("\x1b[6 q")
+	case cursorBlock:
+		os.Stdout.WriteString("\x1b[2 q")
+	default:
+		os.Stdout.WriteString("\x1b[0 q")
+	}
+}
+
+func lockFile(f *os.File, exclusive bool) error {
+	how := unix.LOCK_SH
+	if exclusive {
+		how = unix.LOCK_EX
+	}
+	for {
+		err := unix.Flock(int(f.Fd()), how)
+		if err != unix.EINTR {
+			return err
+		}
+	}
+}
+
+func unlockFile(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_UN)
+}
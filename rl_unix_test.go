@@ -3,22 +3,139 @@
 
 package rl
 
-import "testing"
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
 
-func TestDecodeRunesKeepsIncompleteUTF8(t *testing.T) {
-	rs, pending := decodeRunes([]byte{0xe3, 0x81})
-	if len(rs) != 0 {
-		t.Fatalf("decodeRunes returned runes %q, want none", string(rs))
+	"golang.org/x/sys/unix"
+)
+
+func TestDecodeKeysKeepsIncompleteUTF8(t *testing.T) {
+	ks, pending := decodeKeys([]byte{0xe3, 0x81}, false)
+	if len(ks) != 0 {
+		t.Fatalf("decodeKeys returned keys %v, want none", ks)
 	}
 	if len(pending) != 2 {
-		t.Fatalf("decodeRunes pending length = %d, want 2", len(pending))
+		t.Fatalf("decodeKeys pending length = %d, want 2", len(pending))
 	}
 
-	rs, pending = decodeRunes(append(pending, 0x82))
-	if string(rs) != "あ" {
-		t.Fatalf("decodeRunes = %q, want %q", string(rs), "あ")
+	ks, pending = decodeKeys(append(pending, 0x82), false)
+	if !reflect.DeepEqual(ks, []Key{{Rune: 'あ'}}) {
+		t.Fatalf("decodeKeys = %v, want %q", ks, "あ")
 	}
 	if len(pending) != 0 {
-		t.Fatalf("decodeRunes pending length = %d, want 0", len(pending))
+		t.Fatalf("decodeKeys pending length = %d, want 0", len(pending))
+	}
+}
+
+func TestRefreshWakesReadKeys(t *testing.T) {
+	var p [2]int
+	if err := unix.Pipe(p[:]); err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(p[0])
+	defer unix.Close(p[1])
+
+	c := &ctx{in: uintptr(p[0])}
+	if err := c.openWake(); err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(c.wake_r)
+	defer unix.Close(c.wake_w)
+
+	r := NewRl()
+	r.active = c
+	r.Refresh()
+	r.Refresh()
+	ks, err := c.readKeys()
+	if err != nil || len(ks) != 0 || !c.refresh {
+		t.Fatalf("readKeys = %v, %v with refresh %v, want no keys and refresh", ks, err, c.refresh)
+	}
+
+	c.refresh = false
+	unix.Write(p[1], []byte("a"))
+	ks, err = c.readKeys()
+	if err != nil || !reflect.DeepEqual(ks, []Key{{Rune: 'a'}}) || c.refresh {
+		t.Fatalf("readKeys = %v, %v with refresh %v, want 'a' alone", ks, err, c.refresh)
+	}
+}
+
+func TestKeyseqTimeout(t *testing.T) {
+	var p [2]int
+	if err := unix.Pipe(p[:]); err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(p[0])
+	defer unix.Close(p[1])
+
+	c := &ctx{in: uintptr(p[0])}
+	if err := c.openWake(); err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(c.wake_r)
+	defer unix.Close(c.wake_w)
+
+	e := viEditor("")
+	e.c = c
+	e.r.KeyseqTimeout = 10 * time.Millisecond
+	e.r.ViInsertKeymap.Bind("jk", "vi-movement-mode")
+
+	// A j with nothing after it is typed once the timeout passes.
+	runKeys(e, Key{Rune: 'j'})
+	if e.c.input.String() != "j" || e.viCommand {
+		t.Fatalf("after j got %q in command mode %v, want %q in insert mode", e.c.input.String(), e.viCommand, "j")
+	}
+
+	// A k arriving in time completes the sequence.
+	unix.Write(p[1], []byte("k"))
+	runKeys(e, Key{Rune: 'j'})
+	if e.c.input.String() != "j" || !e.viCommand {
+		t.Fatalf("after jk got %q in command mode %v, want %q in command mode", e.c.input.String(), e.viCommand, "j")
+	}
+}
+
+func TestKeysReadAheadKeptForNextLine(t *testing.T) {
+	var p [2]int
+	if err := unix.Pipe(p[:]); err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(p[0])
+	defer unix.Close(p[1])
+
+	stdout := os.Stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+
+	r := NewRl()
+	newTestCtx := func() *ctx {
+		c := &ctx{in: uintptr(p[0]), size: 80}
+		if err := c.openWake(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			unix.Close(c.wake_r)
+			unix.Close(c.wake_w)
+		})
+		return c
+	}
+
+	// Two lines and the start of a third arrive in one read.
+	unix.Write(p[1], []byte("a\rb\r\xe3\x81"))
+	for _, want := range []string{"a", "b"} {
+		line, err := r.edit(newTestCtx(), false)
+		if err != nil || line != want {
+			t.Fatalf("edit = %q, %v, want %q", line, err, want)
+		}
+	}
+	unix.Write(p[1], []byte("\x82\r"))
+	if line, err := r.edit(newTestCtx(), false); err != nil || line != "あ" {
+		t.Fatalf("edit = %q, %v, want %q", line, err, "あ")
 	}
 }
@@ -1,9 +1,10 @@
 package rl
 
 import (
-	"github.com/mattn/go-runewidth"
 	"os"
+	"strings"
 	"syscall"
+	"time"
 	"unicode/utf16"
 	"unsafe"
 )
@@ -24,27 +25,68 @@ const (
 	keyEvent              = 0x1
 	mouseEvent            = 0x2
 	windowBufferSizeEvent = 0x4
+	focusEvent            = 0x10
+
+	rightAltPressed  = 0x1
+	leftAltPressed   = 0x2
+	rightCtrlPressed = 0x4
+	leftCtrlPressed  = 0x8
+	shiftPressed     = 0x10
+
+	lockfileExclusiveLock = 0x2
 )
 
+// virtualKeys maps virtual key codes to keys that do not produce a
+// character.
+var virtualKeys = map[word]KeyCode{
+	0x21: KeyPageUp,
+	0x22: KeyPageDown,
+	0x23: KeyEnd,
+	0x24: KeyHome,
+	0x25: KeyLeft,
+	0x26: KeyUp,
+	0x27: KeyRight,
+	0x28: KeyDown,
+	0x2D: KeyInsert,
+	0x2E: KeyDelete,
+	0x70: KeyF1,
+	0x71: KeyF2,
+	0x72: KeyF3,
+	0x73: KeyF4,
+	0x74: KeyF5,
+	0x75: KeyF6,
+	0x76: KeyF7,
+	0x77: KeyF8,
+	0x78: KeyF9,
+	0x79: KeyF10,
+	0x7A: KeyF11,
+	0x7B: KeyF12,
+}
+
 var kernel32 = syscall.NewLazyDLL("kernel32.dll")
 
 var (
-	procSetStdHandle                = kernel32.NewProc("SetStdHandle")
-	procGetStdHandle                = kernel32.NewProc("GetStdHandle")
-	procSetConsoleScreenBufferSize  = kernel32.NewProc("SetConsoleScreenBufferSize")
-	procCreateConsoleScreenBuffer   = kernel32.NewProc("CreateConsoleScreenBuffer")
-	procGetConsoleScreenBufferInfo  = kernel32.NewProc("GetConsoleScreenBufferInfo")
-	procWriteConsoleOutputCharacter = kernel32.NewProc("WriteConsoleOutputCharacterW")
-	procWriteConsoleOutputAttribute = kernel32.NewProc("WriteConsoleOutputAttribute")
-	procGetConsoleCursorInfo        = kernel32.NewProc("GetConsoleCursorInfo")
-	procSetConsoleCursorInfo        = kernel32.NewProc("SetConsoleCursorInfo")
-	procSetConsoleCursorPosition    = kernel32.NewProc("SetConsoleCursorPosition")
-	procReadConsoleInput            = kernel32.NewProc("ReadConsoleInputW")
-	procGetConsoleMode              = kernel32.NewProc("GetConsoleMode")
-	procSetConsoleMode              = kernel32.NewProc("SetConsoleMode")
-	procFillConsoleOutputCharacter  = kernel32.NewProc("FillConsoleOutputCharacterW")
-	procFillConsoleOutputAttribute  = kernel32.NewProc("FillConsoleOutputAttribute")
-	procScrollConsoleScreenBuffer   = kernel32.NewProc("ScrollConsoleScreenBufferW")
+	procSetStdHandle                  = kernel32.NewProc("SetStdHandle")
+	procGetStdHandle                  = kernel32.NewProc("GetStdHandle")
+	procSetConsoleScreenBufferSize    = kernel32.NewProc("SetConsoleScreenBufferSize")
+	procCreateConsoleScreenBuffer     = kernel32.NewProc("CreateConsoleScreenBuffer")
+	procGetConsoleScreenBufferInfo    = kernel32.NewProc("GetConsoleScreenBufferInfo")
+	procWriteConsoleOutputCharacter   = kernel32.NewProc("WriteConsoleOutputCharacterW")
+	procWriteConsoleOutputAttribute   = kernel32.NewProc("WriteConsoleOutputAttribute")
+	procGetConsoleCursorInfo          = kernel32.NewProc("GetConsoleCursorInfo")
+	procSetConsoleCursorInfo          = kernel32.NewProc("SetConsoleCursorInfo")
+	procSetConsoleCursorPosition      = kernel32.NewProc("SetConsoleCursorPosition")
+	procReadConsoleInput              = kernel32.NewProc("ReadConsoleInputW")
+	procPeekConsoleInput              = kernel32.NewProc("PeekConsoleInputW")
+	procWriteConsoleInput             = kernel32.NewProc("WriteConsoleInputW")
+	procGetNumberOfConsoleInputEvents = kernel32.NewProc("GetNumberOfConsoleInputEvents")
+	procGetConsoleMode                = kernel32.NewProc("GetConsoleMode")
+	procSetConsoleMode                = kernel32.NewProc("SetConsoleMode")
+	procFillConsoleOutputCharacter    = kernel32.NewProc("FillConsoleOutputCharacterW")
+	procFillConsoleOutputAttribute    = kernel32.NewProc("FillConsoleOutputAttribute")
+	procScrollConsoleScreenBuffer     = kernel32.NewProc("ScrollConsoleScreenBufferW")
+	procLockFileEx                    = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx                  = kernel32.NewProc("UnlockFileEx")
 )
 
 type wchar uint16
@@ -136,20 +178,31 @@ func writeConsole(fd uintptr, rs []rune) error {
 	return syscall.WriteConsole(syscall.Handle(fd), &wchars[0], uint32(len(wchars)), &w, nil)
 }
 
-func readConsoleInput(fd uintptr, record *inputRecord) (err error) {
+// readConsoleInput reads up to len(records) events, blocking until there
+// is at least one, and returns how many were read.
+func readConsoleInput(fd uintptr, records []inputRecord) (int, error) {
 	var w uint32
-	r1, _, err := procReadConsoleInput.Call(fd, uintptr(unsafe.Pointer(record)), 1, uintptr(unsafe.Pointer(&w)))
+	r1, _, err := procReadConsoleInput.Call(fd, uintptr(unsafe.Pointer(&records[0])), uintptr(len(records)), uintptr(unsafe.Pointer(&w)))
 	if r1 == 0 {
-		return err
+		return 0, err
 	}
-	return nil
+	return int(w), nil
+}
+
+func peekConsoleInput(fd uintptr, records []inputRecord) (int, error) {
+	var w uint32
+	r1, _, err := procPeekConsoleInput.Call(fd, uintptr(unsafe.Pointer(&records[0])), uintptr(len(records)), uintptr(unsafe.Pointer(&w)))
+	if r1 == 0 {
+		return 0, err
+	}
+	return int(w), nil
 }
 
 type ctx struct {
 	in       uintptr
 	out      uintptr
 	st       uint32
-	input    []rune
+	input    buffer
 	last     []rune
 	prompt   string
 	cursor_x int
@@ -157,28 +210,162 @@ type ctx struct {
 	old_crow int
 	size     int
 	old_size int
+	// hl_start and hl_end delimit a range of input shown highlighted.
+	hl_start int
+	hl_end   int
+	// head holds the lines of a multi-line prompt above the line. They are
+	// drawn once, taking head_rows rows, until head_drawn is cleared.
+	head       string
+	head_rows  int
+	head_drawn bool
+	// clear asks the next redraw to clear the screen first.
+	clear bool
+	// rprompt is the right prompt.
+	rprompt string
+	// refresh is set by readKeys when it reads the event written by wake.
+	refresh bool
+	// surrogate holds the high surrogate of a character outside the BMP,
+	// which arrives in two key events, until its low surrogate is read.
+	surrogate wchar
 }
 
-func (c *ctx) readRunes() ([]rune, error) {
-	var ir inputRecord
-	err := readConsoleInput(c.in, &ir)
+func (c *ctx) readKeys() ([]Key, error) {
+	var irs [128]inputRecord
+	n, err := readConsoleInput(c.in, irs[:])
 	if err != nil {
 		return nil, err
 	}
 
-	switch ir.eventType {
-	case keyEvent:
-		kr := (*keyEventRecord)(unsafe.Pointer(&ir.event))
-		if kr.keyDown != 0 {
-			return []rune{rune(kr.unicodeChar)}, nil
+	var ks []Key
+	for _, ir := range irs[:n] {
+		switch ir.eventType {
+		case keyEvent:
+			kr := (*keyEventRecord)(unsafe.Pointer(&ir.event))
+			if kr.keyDown != 0 {
+				if k, ok := c.keyEventKey(kr); ok {
+					ks = append(ks, k)
+				}
+			}
+		case focusEvent:
+			// Written by wake, or a real focus change: either way a
+			// redraw does no harm.
+			c.refresh = true
+		case windowBufferSizeEvent:
+			//sr := *(*windowBufferSizeRecord)(unsafe.Pointer(&ir.event))
+		case mouseEvent:
+			//mr := *(*mouseEventRecord)(unsafe.Pointer(&ir.event))
+		}
+	}
+	return ks, nil
+}
+
+// wake makes a blocked readKeys return so that the line is redrawn, by
+// writing a focus event to the console input. It may be called from
+// another goroutine.
+func (c *ctx) wake() {
+	ir := inputRecord{eventType: focusEvent}
+	var w uint32
+	procWriteConsoleInput.Call(c.in, uintptr(unsafe.Pointer(&ir)), 1, uintptr(unsafe.Pointer(&w)))
+}
+
+// pendingInput returns nil: console input is read as whole key events,
+// which leave nothing to decode later.
+func (c *ctx) pendingInput() []byte {
+	return nil
+}
+
+func (c *ctx) setPendingInput(b []byte) {}
+
+// inputReady reports whether input events are waiting to be read.
+func (c *ctx) inputReady() bool {
+	var n uint32
+	r1, _, _ := procGetNumberOfConsoleInputEvents.Call(c.in, uintptr(unsafe.Pointer(&n)))
+	return r1 != 0 && n > 0
+}
+
+// waitInput reports whether a key press arrives within timeout
+// milliseconds. The console input is signaled by any event, so the events
+// that give no key, such as key releases, are read and dropped while
+// waiting, as readKeys would drop them.
+func (c *ctx) waitInput(timeout int) (bool, error) {
+	deadline := time.Now().Add(time.Duration(timeout) * time.Millisecond)
+	var irs [128]inputRecord
+	for {
+		n, err := peekConsoleInput(c.in, irs[:])
+		if err != nil {
+			return false, err
+		}
+		for _, ir := range irs[:n] {
+			if ir.eventType != keyEvent {
+				continue
+			}
+			kr := (*keyEventRecord)(unsafe.Pointer(&ir.event))
+			if _, ok := virtualKeys[kr.virtualKeyCode]; kr.keyDown != 0 && (ok || kr.unicodeChar != 0) {
+				return true, nil
+			}
+		}
+		if n > 0 {
+			// Read only the events looked at, not a key that came since.
+			if _, err := readConsoleInput(c.in, irs[:n]); err != nil {
+				return false, err
+			}
+			for _, ir := range irs[:n] {
+				if ir.eventType == focusEvent {
+					c.refresh = true
+				}
+			}
+			continue
+		}
+
+		left := time.Until(deadline)
+		if left <= 0 {
+			return false, nil
+		}
+		ev, err := syscall.WaitForSingleObject(syscall.Handle(c.in), uint32((left+time.Millisecond-1)/time.Millisecond))
+		if ev == syscall.WAIT_FAILED {
+			return false, err
+		}
+		if ev != syscall.WAIT_OBJECT_0 {
+			return false, nil
 		}
-	case windowBufferSizeEvent:
-		//sr := *(*windowBufferSizeRecord)(unsafe.Pointer(&ir.event))
-	case mouseEvent:
-		//mr := *(*mouseEventRecord)(unsafe.Pointer(&ir.event))
 	}
+}
 
-	return nil, nil
+func (c *ctx) keyEventKey(kr *keyEventRecord) (Key, bool) {
+	alt := kr.controlKeyState&(leftAltPressed|rightAltPressed) != 0
+	ctrl := kr.controlKeyState&(leftCtrlPressed|rightCtrlPressed) != 0
+	shift := kr.controlKeyState&shiftPressed != 0
+
+	if code, ok := virtualKeys[kr.virtualKeyCode]; ok {
+		return Key{Code: code, Ctrl: ctrl, Alt: alt, Shift: shift}, true
+	}
+	if kr.unicodeChar == 0 {
+		return Key{}, false
+	}
+
+	// Events without a character, such as those for modifier keys, may
+	// come between the two halves of a surrogate pair.
+	hi := c.surrogate
+	c.surrogate = 0
+	r := rune(kr.unicodeChar)
+	if utf16.IsSurrogate(r) {
+		if r < 0xdc00 {
+			c.surrogate = kr.unicodeChar
+			return Key{}, false
+		}
+		// A low surrogate without a high one before it decodes to
+		// U+FFFD.
+		r = utf16.DecodeRune(rune(hi), r)
+	}
+	k := runeKey(r)
+	// AltGr is reported as Ctrl+Alt; the character already reflects it.
+	if alt && !(ctrl && k.Code == KeyRune && !k.Ctrl) {
+		k.Alt = true
+	}
+	if k.Code == KeyTab && shift {
+		k.Shift = true
+	}
+	return k, true
 }
 
 func newCtx(prompt string) (*ctx, error) {
@@ -187,13 +374,15 @@ func newCtx(prompt string) (*ctx, error) {
 		c.in = getStdHandle(syscall.STD_INPUT_HANDLE)
 		c.out = getStdHandle(syscall.STD_OUTPUT_HANDLE)
 	} else {
-		conin, err := os.Open("CONIN$")
+		// Both need write access: wake writes to the console input and
+		// SetConsoleMode and the redraw change the console.
+		conin, err := os.OpenFile("CONIN$", os.O_RDWR, 0)
 		if err != nil {
 			return nil, err
 		}
 		c.in = conin.Fd()
 
-		conout, err := os.Open("CONOUT$")
+		conout, err := os.OpenFile("CONOUT$", os.O_RDWR, 0)
 		if err != nil {
 			return nil, err
 		}
@@ -221,7 +410,7 @@ func newCtx(prompt string) (*ctx, error) {
 	}
 
 	c.prompt = prompt
-	c.input = []rune{}
+	c.input = newBuffer("")
 	c.last = []rune{}
 	c.size = int(csbi.size.x)
 	c.old_size = c.size
@@ -233,6 +422,115 @@ func (c *ctx) tearDown() {
 	procSetConsoleMode.Call(c.in, uintptr(c.st))
 }
 
+// enableBracketedPaste does nothing: the console reports pasted text as
+// ordinary key events.
+func (c *ctx) enableBracketedPaste() {
+}
+
+// setCursorShape changes the cursor between a thin line, the console's
+// usual cursor, and a full block.
+func (c *ctx) setCursorShape(shape cursorShape) {
+	var ci consoleCursorInfo
+	r1, _, _ := procGetConsoleCursorInfo.Call(c.out, uintptr(unsafe.Pointer(&ci)))
+	if r1 == 0 {
+		return
+	}
+	switch shape {
+	case cursorBlock:
+		ci.size = 100
+	case cursorBar:
+		ci.size = 10
+	default:
+		ci.size = 25
+	}
+	procSetConsoleCursorInfo.Call(c.out, uintptr(unsafe.Pointer(&ci)))
+}
+
+// clearRow blanks the row at pos and resets its colors.
+func (c *ctx) clearRow(pos coord, csbi consoleScreenBufferInfo) error {
+	var w uint32
+	r1, _, err := procFillConsoleOutputCharacter.Call(c.out, uintptr(' '), uintptr(csbi.size.x), uintptr(*(*int32)(unsafe.Pointer(&pos))), uintptr(unsafe.Pointer(&w)))
+	if r1 == 0 {
+		return err
+	}
+	r1, _, err = procFillConsoleOutputAttribute.Call(c.out, uintptr(csbi.attributes), uintptr(csbi.size.x), uintptr(*(*int32)(unsafe.Pointer(&pos))), uintptr(unsafe.Pointer(&w)))
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}
+
+// clearScreen blanks the whole screen buffer and moves the cursor to the
+// top, like cls.
+func (c *ctx) clearScreen(csbi consoleScreenBufferInfo) error {
+	var w uint32
+	var home coord
+	n := uintptr(csbi.size.x) * uintptr(csbi.size.y)
+	r1, _, err := procFillConsoleOutputCharacter.Call(c.out, uintptr(' '), n, uintptr(*(*int32)(unsafe.Pointer(&home))), uintptr(unsafe.Pointer(&w)))
+	if r1 == 0 {
+		return err
+	}
+	r1, _, err = procFillConsoleOutputAttribute.Call(c.out, uintptr(csbi.attributes), n, uintptr(*(*int32)(unsafe.Pointer(&home))), uintptr(unsafe.Pointer(&w)))
+	if r1 == 0 {
+		return err
+	}
+	r1, _, err = procSetConsoleCursorPosition.Call(c.out, uintptr(*(*int32)(unsafe.Pointer(&home))))
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}
+
+// drawHead replaces the lines of a multi-line prompt above the line,
+// leaving the cursor at the start of the row below them. Escape sequences
+// in the prompt are left out.
+func (c *ctx) drawHead(csbi consoleScreenBufferInfo) error {
+	top := csbi.cursorPosition.y - short(c.old_crow) - short(c.head_rows)
+	if top < 0 {
+		top = 0
+	}
+	pos := coord{y: top}
+	for ; pos.y < csbi.size.y && int(pos.y-top) <= c.head_rows+c.old_row; pos.y++ {
+		if err := c.clearRow(pos, csbi); err != nil {
+			return err
+		}
+	}
+	pos.y = top
+	r1, _, err := procSetConsoleCursorPosition.Call(c.out, uintptr(*(*int32)(unsafe.Pointer(&pos))))
+	if r1 == 0 {
+		return err
+	}
+
+	head := strings.ReplaceAll(visiblePrompt(c.head), "\n", "\r\n")
+	if err := writeConsole(c.out, []rune(head)); err != nil {
+		return err
+	}
+	c.old_row, c.old_crow = 0, 0
+	c.head_rows = headRows(c.head, c.size)
+	c.head_drawn = true
+	return nil
+}
+
+// drawRightPrompt writes the right prompt at pos, leaving out escape
+// sequences.
+func (c *ctx) drawRightPrompt(pos coord) error {
+	wchars := utf16.Encode([]rune(visiblePrompt(c.rprompt)))
+	if len(wchars) == 0 {
+		return nil
+	}
+	var w uint32
+	r1, _, err := procWriteConsoleOutputCharacter.Call(c.out, uintptr(unsafe.Pointer(&wchars[0])), uintptr(len(wchars)), uintptr(*(*int32)(unsafe.Pointer(&pos))), uintptr(unsafe.Pointer(&w)))
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}
+
+// reverseAttributes swaps the foreground and background colors of attr.
+func reverseAttributes(attr word) word {
+	return attr&^0xff | attr&0x0f<<4 | attr&0xf0>>4
+}
+
 func (c *ctx) redraw(dirty bool, passwordChar rune) error {
 	var csbi consoleScreenBufferInfo
 
@@ -255,6 +553,25 @@ func (c *ctx) redraw(dirty bool, passwordChar rune) error {
 	if r1 == 0 {
 		return err
 	}
+	if c.clear {
+		if err := c.clearScreen(csbi); err != nil {
+			return err
+		}
+		csbi.cursorPosition = coord{}
+		c.old_row, c.old_crow, c.head_rows = 0, 0, 0
+		c.head_drawn = false
+		c.clear = false
+	}
+	if !c.head_drawn {
+		if err := c.drawHead(csbi); err != nil {
+			return err
+		}
+		r1, _, err = procGetConsoleScreenBufferInfo.Call(c.out, uintptr(unsafe.Pointer(&csbi)))
+		if r1 == 0 {
+			return err
+		}
+		dirty = true
+	}
 
 	var oldpos, cursor coord
 	oldpos.x = 0
@@ -266,18 +583,10 @@ func (c *ctx) redraw(dirty bool, passwordChar rune) error {
 		return err
 	}
 	if dirty {
-		var w uint32
-		r1, _, err = procFillConsoleOutputCharacter.Call(c.out, uintptr(' '), uintptr(csbi.size.x), uintptr(*(*int32)(unsafe.Pointer(&cursor))), uintptr(unsafe.Pointer(&w)))
-		if r1 == 0 {
-			return err
-		}
-	}
-	cursor.y -= short(c.old_row - c.old_crow)
-	if dirty {
-		for i := 0; i < c.old_row; i++ {
-			var w uint32
-			r1, _, err = procFillConsoleOutputCharacter.Call(c.out, uintptr(' '), uintptr(csbi.size.x), uintptr(*(*int32)(unsafe.Pointer(&cursor))), uintptr(unsafe.Pointer(&w)))
-			if r1 == 0 {
+		// Clear every row of the old line, since a shorter prompt would
+		// leave the end of the old one behind.
+		for i := 0; i <= c.old_row; i++ {
+			if err := c.clearRow(cursor, csbi); err != nil {
 				return err
 			}
 			cursor.y++
@@ -286,38 +595,54 @@ func (c *ctx) redraw(dirty bool, passwordChar rune) error {
 
 	var rs []rune
 	if passwordChar != 0 {
-		for i := 0; i < len(c.input); i++ {
+		for i := 0; i < c.input.len(); i++ {
 			rs = append(rs, passwordChar)
 		}
 	} else {
-		rs = c.input
+		// Copy the line rather than moving the gap away from the cursor.
+		rs = c.input.slice(0, c.input.len())
 	}
 
 	var ccol, crow, col, row int
 	ccol = -1
-	plen := len([]rune(c.prompt))
+	width := -1 // of the first row
 	curr := []rune(c.prompt + string(rs))
-	for i, r := range curr {
-		if i == plen+c.cursor_x {
+	for _, cl := range lineCells(c.prompt, rs) {
+		if cl.pos >= 0 && ccol == -1 && c.cursor_x < cl.pos+cl.n {
 			ccol = col
 			crow = row
 		}
-		rw := runewidth.RuneWidth(r)
+		if cl.hidden {
+			// The console cannot interpret escape sequences written
+			// with WriteConsoleOutputCharacter, so drop them.
+			continue
+		}
 		if dirty {
 			cursor.x = oldpos.x + short(col)
 			cursor.y = oldpos.y + short(row)
 			var w uint32
-			// Write the rune once. The console automatically reserves the
-			// trailing cell for full-width characters, so filling rw cells
-			// would draw the glyph twice (visible on the last character,
-			// since later characters overwrite the stray trailing copy).
-			r1, _, err = procFillConsoleOutputCharacter.Call(c.out, uintptr(r), uintptr(1), uintptr(*(*int32)(unsafe.Pointer(&cursor))), uintptr(unsafe.Pointer(&w)))
+			// Write the cluster once. The console automatically reserves
+			// the trailing cell for full-width characters, so filling
+			// every cell of its width would draw the glyph twice (visible
+			// on the last character, since later characters overwrite the
+			// stray trailing copy).
+			wchars := utf16.Encode([]rune(cl.s))
+			r1, _, err = procWriteConsoleOutputCharacter.Call(c.out, uintptr(unsafe.Pointer(&wchars[0])), uintptr(len(wchars)), uintptr(*(*int32)(unsafe.Pointer(&cursor))), uintptr(unsafe.Pointer(&w)))
 			if r1 == 0 {
 				return err
 			}
+			if cl.pos >= c.hl_start && cl.pos < c.hl_end {
+				r1, _, err = procFillConsoleOutputAttribute.Call(c.out, uintptr(reverseAttributes(csbi.attributes)), uintptr(cl.width), uintptr(*(*int32)(unsafe.Pointer(&cursor))), uintptr(unsafe.Pointer(&w)))
+				if r1 == 0 {
+					return err
+				}
+			}
 		}
-		col += rw
+		col += cl.width
 		if col >= c.size {
+			if row == 0 {
+				width = col
+			}
 			col = 0
 			row++
 			if short(row) >= csbi.size.y-oldpos.y {
@@ -330,6 +655,14 @@ func (c *ctx) redraw(dirty bool, passwordChar rune) error {
 		}
 	}
 	c.last = curr
+	if width == -1 {
+		width = col
+	}
+	if rcol := rightPromptCol(c.rprompt, width, c.size); dirty && rcol >= 0 {
+		if err := c.drawRightPrompt(coord{x: oldpos.x + short(rcol), y: oldpos.y}); err != nil {
+			return err
+		}
+	}
 
 	if ccol == -1 {
 		ccol = col
@@ -353,3 +686,25 @@ func (c *ctx) redraw(dirty bool, passwordChar rune) error {
 
 	return nil
 }
+
+func lockFile(f *os.File, exclusive bool) error {
+	var flags uintptr
+	if exclusive {
+		flags = lockfileExclusiveLock
+	}
+	var ol syscall.Overlapped
+	r1, _, err := procLockFileEx.Call(f.Fd(), flags, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	var ol syscall.Overlapped
+	r1, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package rl
+
+// indexRunes returns the position of q in s, searching from position from
+// towards the start of s when backward is set and towards the end
+// otherwise. It returns -1 when q does not occur.
+func indexRunes(s, q []rune, from int, backward bool) int {
+	if len(q) > len(s) {
+		return -1
+	}
+	if from > len(s)-len(q) {
+		if !backward {
+			return -1
+		}
+		from = len(s) - len(q)
+	}
+	if from < 0 {
+		if backward {
+			return -1
+		}
+		from = 0
+	}
+
+	step := 1
+	if backward {
+		step = -1
+	}
+	for i := from; i >= 0 && i <= len(s)-len(q); i += step {
+		if string(s[i:i+len(q)]) == string(q) {
+			return i
+		}
+	}
+	return -1
+}
+
+// searchLines looks for q in lines, starting at position pos of line idx
+// and moving to older lines when backward is set or newer lines otherwise.
+// It returns the line and position of the match.
+func searchLines(lines [][]rune, q []rune, idx, pos int, backward bool) (int, int, bool) {
+	for idx >= 0 && idx < len(lines) {
+		if i := indexRunes(lines[idx], q, pos, backward); i >= 0 {
+			return idx, i, true
+		}
+		if backward {
+			idx--
+			if idx >= 0 {
+				pos = len(lines[idx])
+			}
+		} else {
+			idx++
+			pos = 0
+		}
+	}
+	return 0, 0, false
+}
+
+func searchPrompt(query []rune, backward, failed bool) string {
+	p := "(i-search)'"
+	if backward {
+		p = "(reverse-i-search)'"
+	}
+	if failed {
+		p = "(failed " + p[1:]
+	}
+	return p + string(query) + "': "
+}
+
+// isearch runs an incremental history search started by Ctrl-R or Ctrl-S.
+// Keys that do not belong to the search end it and are handed back to the
+// editor, so Enter accepts the found line and Ctrl-A starts editing it.
+func (e *Editor) isearch(backward bool) error {
+	if e.password {
+		return nil
+	}
+
+	prompt, orig, origCursor := e.c.prompt, e.c.input.slice(0, e.c.input.len()), e.c.cursor_x
+	defer func() {
+		e.c.prompt = prompt
+		e.c.hl_start, e.c.hl_end = 0, 0
+		e.dirty = true
+	}()
+
+	lines := make([][]rune, len(e.r.history)+1)
+	for i, h := range e.r.history {
+		lines[i] = []rune(h)
+	}
+	lines[len(e.r.history)] = e.scratch
+	lines[e.histIdx] = orig
+
+	type state struct {
+		idx, pos int
+		failed   bool
+	}
+	cur := state{idx: e.histIdx, pos: origCursor}
+	var stack []state
+	var query []rune
+
+	for {
+		e.c.prompt = searchPrompt(query, backward, cur.failed)
+		e.c.input.set(lines[cur.idx])
+		e.c.cursor_x = cur.pos
+		e.c.hl_start, e.c.hl_end = cur.pos, cur.pos
+		if !cur.failed && len(query) > 0 {
+			e.c.hl_end = cur.pos + len(query)
+		}
+		e.dirty = true
+
+		k, err := e.readKey()
+		if err != nil {
+			return err
+		}
+
+		next := cur
+		switch {
+		case k == ctrlKey('r') || k == ctrlKey('s'):
+			backward = k == ctrlKey('r')
+			if len(query) == 0 {
+				query = []rune(e.r.lastSearch)
+			} else if backward {
+				next.pos--
+			} else {
+				next.pos++
+			}
+		case k == Key{Code: KeyBackspace}:
+			if len(stack) > 0 {
+				cur, stack = stack[len(stack)-1], stack[:len(stack)-1]
+				query = query[:len(query)-1]
+			}
+			continue
+		case k == ctrlKey('g') || k == Key{Code: KeyEscape}:
+			e.c.input.set(orig)
+			e.c.cursor_x = origCursor
+			return nil
+		case isSelfInsert(k):
+			stack = append(stack, cur)
+			query = append(query, k.Rune)
+		default:
+			e.r.lastSearch = string(query)
+			if cur.idx != e.histIdx {
+				if e.histIdx == len(e.r.history) {
+					e.scratch = orig
+				}
+				e.histIdx = cur.idx
+				e.resetUndo()
+			}
+			e.keys = append([]Key{k}, e.keys...)
+			return nil
+		}
+
+		if len(query) == 0 {
+			cur = next
+			continue
+		}
+		if idx, pos, ok := searchLines(lines, query, next.idx, next.pos, backward); ok {
+			cur = state{idx: idx, pos: pos}
+		} else {
+			cur.failed = true
+		}
+	}
+}
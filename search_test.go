@@ -0,0 +1,63 @@
+package rl
+
+import "testing"
+
+func searchEditor(input string, keys ...Key) *Editor {
+	r := NewRl()
+	for _, h := range []string{"git status", "ls -l", "git commit"} {
+		r.AddHistory(h)
+	}
+	in := []rune(input)
+	return &Editor{r: r, c: &ctx{input: newBuffer(input), cursor_x: len(in)}, histIdx: 3, keys: keys}
+}
+
+func typeKeys(s string) []Key {
+	var ks []Key
+	for _, r := range s {
+		ks = append(ks, Key{Rune: r})
+	}
+	return ks
+}
+
+func TestSearchLines(t *testing.T) {
+	lines := [][]rune{[]rune("abc abc"), []rune("xyz"), []rune("")}
+	idx, pos, ok := searchLines(lines, []rune("abc"), 2, 0, true)
+	if !ok || idx != 0 || pos != 4 {
+		t.Fatalf("searchLines backward = %d, %d, %v, want 0, 4, true", idx, pos, ok)
+	}
+	idx, pos, ok = searchLines(lines, []rune("abc"), 0, 3, true)
+	if !ok || idx != 0 || pos != 0 {
+		t.Fatalf("searchLines backward from 3 = %d, %d, %v, want 0, 0, true", idx, pos, ok)
+	}
+	if _, _, ok := searchLines(lines, []rune("abc"), 0, 5, false); ok {
+		t.Fatal("searchLines forward past last match returned ok")
+	}
+}
+
+func TestIsearchAcceptsMatch(t *testing.T) {
+	keys := append(typeKeys("git"), ctrlKey('r'), Key{Code: KeyEnter})
+	e := searchEditor("", keys...)
+	if err := e.isearch(true); err != nil {
+		t.Fatal(err)
+	}
+	if e.c.input.String() != "git status" || e.histIdx != 0 {
+		t.Fatalf("isearch = %q at %d, want %q at 0", e.c.input.String(), e.histIdx, "git status")
+	}
+	if len(e.keys) != 1 || e.keys[0] != (Key{Code: KeyEnter}) {
+		t.Fatalf("isearch left keys %v, want Enter", e.keys)
+	}
+	if e.c.prompt != "" || e.c.hl_end != 0 {
+		t.Fatalf("isearch left prompt %q and highlight end %d", e.c.prompt, e.c.hl_end)
+	}
+}
+
+func TestIsearchAbortRestoresLine(t *testing.T) {
+	keys := append(typeKeys("ls"), ctrlKey('g'))
+	e := searchEditor("draft", keys...)
+	if err := e.isearch(true); err != nil {
+		t.Fatal(err)
+	}
+	if e.c.input.String() != "draft" || e.c.cursor_x != 5 || e.histIdx != 3 {
+		t.Fatalf("isearch abort = %q cursor %d at %d, want %q cursor 5 at 3", e.c.input.String(), e.c.cursor_x, e.histIdx, "draft")
+	}
+}
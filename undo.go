@@ -0,0 +1,104 @@
+package rl
+
+import "unicode"
+
+// change is a step of the undo history: the edits made by a command, or
+// by a run of typed characters, with the cursor before and after them.
+type change struct {
+	edits  []edit
+	before int
+	after  int
+}
+
+type snapshot struct {
+	input  []rune
+	cursor int
+}
+
+func (e *Editor) snapshot() snapshot {
+	return snapshot{input: e.c.input.slice(0, e.c.input.len()), cursor: e.c.cursor_x}
+}
+
+func (e *Editor) restore(s snapshot) {
+	e.c.input.set(s.input)
+	e.c.cursor_x = s.cursor
+	e.dirty = true
+}
+
+// recordUndo saves the edits made by the command run for k, with the
+// cursor before it, if the command changed the line. Runs of typed
+// characters are grouped so that a single undo removes a whole word, and
+// a vi change, like cw and the text typed up to Escape, is undone whole.
+func (e *Editor) recordUndo(edits []edit, before int, k Key) {
+	if e.thisCmd == cmdUndo || e.thisCmd == cmdLoad || len(edits) == 0 {
+		return
+	}
+	e.redo = nil
+
+	if e.viInChange && len(e.undo) > e.viUndoMark {
+		last := &e.undo[len(e.undo)-1]
+		last.edits = append(last.edits, edits...)
+		last.after = e.c.cursor_x
+		return
+	}
+
+	if e.thisCmd == cmdInsert {
+		grouped := e.lastCmd == cmdInsert && len(e.undo) > 0 && !(unicode.IsSpace(e.lastInsert) && !unicode.IsSpace(k.Rune))
+		if e.c.cursor_x > 0 {
+			e.lastInsert = e.c.input.at(e.c.cursor_x - 1)
+		}
+		if grouped {
+			last := &e.undo[len(e.undo)-1]
+			last.edits = append(last.edits, edits...)
+			last.after = e.c.cursor_x
+			return
+		}
+	}
+	e.undo = append(e.undo, change{edits: edits, before: before, after: e.c.cursor_x})
+}
+
+// resetUndo starts a fresh undo history for a line loaded into the editor,
+// which revertLine goes back to.
+func (e *Editor) resetUndo() {
+	e.undo, e.redo = nil, nil
+	e.origin = e.snapshot()
+	e.thisCmd = cmdLoad
+}
+
+func (e *Editor) undoEdit() {
+	e.thisCmd = cmdUndo
+	if len(e.undo) == 0 {
+		return
+	}
+	ch := e.undo[len(e.undo)-1]
+	e.undo = e.undo[:len(e.undo)-1]
+	for i := len(ch.edits) - 1; i >= 0; i-- {
+		e.c.input.undo(ch.edits[i])
+	}
+	e.c.cursor_x = ch.before
+	e.dirty = true
+	e.redo = append(e.redo, ch)
+}
+
+func (e *Editor) redoEdit() {
+	e.thisCmd = cmdUndo
+	if len(e.redo) == 0 {
+		return
+	}
+	ch := e.redo[len(e.redo)-1]
+	e.redo = e.redo[:len(e.redo)-1]
+	for _, ed := range ch.edits {
+		e.c.input.redo(ed)
+	}
+	e.c.cursor_x = ch.after
+	e.dirty = true
+	e.undo = append(e.undo, ch)
+}
+
+// revertLine undoes every change made to the line since it was loaded.
+// The revert itself can be undone.
+func (e *Editor) revertLine() {
+	if e.c.input.String() != string(e.origin.input) {
+		e.restore(e.origin)
+	}
+}
@@ -0,0 +1,65 @@
+package rl
+
+import "testing"
+
+func TestUndo(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		keys       string
+		want       string
+		cursorWant int
+	}{
+		{"groups words", "", "hello world\x1f", "hello ", 6},
+		{"groups words twice", "", "hello world\x1f\x1f", "", 0},
+		{"redo", "", "hello world\x1f\x1f\x1e\x1e", "hello world", 11},
+		{"kill", "abc def", "\x15\x1f", "abc def", 7},
+		{"C-x C-u", "abc", "d\x18\x15", "abc", 3},
+		{"completion", "", "he\t\x1f", "he", 2},
+		{"yank", "abc", "\x17\x19\x1f", "", 0},
+		{"kill before yank", "abc", "\x17\x19\x1f\x1f", "abc", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRl()
+			r.CompleteFunc = func(string, int) (int, []string) {
+				return 0, []string{"hello"}
+			}
+			e := &Editor{r: r, c: &ctx{input: newBuffer(tt.input), cursor_x: len([]rune(tt.input))}}
+			keys, _ := decodeKeys([]byte(tt.keys), true)
+			runKeys(e, keys...)
+			if e.c.input.String() != tt.want || e.c.cursor_x != tt.cursorWant {
+				t.Fatalf("got %q cursor %d, want %q cursor %d", e.c.input.String(), e.c.cursor_x, tt.want, tt.cursorWant)
+			}
+		})
+	}
+}
+
+func TestRevertLineRestoresHistoryEntry(t *testing.T) {
+	r := NewRl()
+	r.AddHistory("make test")
+	e := &Editor{r: r, c: &ctx{}, histIdx: 1}
+	runKeys(e, append(append([]Key{ctrlKey('p')}, typeKeys(" -v")...), altKey('r'))...)
+	if e.c.input.String() != "make test" {
+		t.Fatalf("revert-line = %q, want %q", e.c.input.String(), "make test")
+	}
+}
+
+func TestWordCommandsRecordOnlyTheWords(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  int
+		key     Key
+		deleted string
+	}{
+		{"upcase", 4, altKey('u'), "two"},
+		{"transpose", 7, altKey('t'), "two three"},
+	}
+	for _, tt := range tests {
+		e := &Editor{r: NewRl(), c: &ctx{input: newBuffer("one two three four"), cursor_x: tt.cursor}}
+		runKeys(e, tt.key)
+		if len(e.undo) != 1 || len(e.undo[0].edits) != 1 || string(e.undo[0].edits[0].deleted) != tt.deleted {
+			t.Fatalf("%s recorded %+v, want one edit of %q", tt.name, e.undo, tt.deleted)
+		}
+	}
+}
@@ -0,0 +1,631 @@
+package rl
+
+import "unicode"
+
+// EditMode selects the key bindings used for editing.
+type EditMode int
+
+const (
+	// ModeEmacs uses Rl.Keymap.
+	ModeEmacs EditMode = iota
+	// ModeVi starts each line in vi insert mode (Rl.ViInsertKeymap); Escape
+	// switches to command mode (Rl.ViCommandKeymap).
+	ModeVi
+)
+
+func (m EditMode) String() string {
+	if m == ModeVi {
+		return "vi"
+	}
+	return "emacs"
+}
+
+var viInsertBindings = []struct {
+	seq  string
+	name string
+}{
+	{`\e`, "vi-movement-mode"},
+	{`\C-c`, "interrupt"},
+	{`\C-d`, "end-of-file"},
+	{`\C-h`, "backward-delete-char"},
+	{`\C-?`, "backward-delete-char"},
+	{`\C-i`, "complete"},
+	{`\C-v`, "quoted-insert"},
+	{`\e[200~`, "bracketed-paste-begin"},
+	{`\C-j`, "accept-line"},
+	{`\C-m`, "accept-line"},
+	{`\C-l`, "clear-screen"},
+	{`\C-r`, "reverse-search-history"},
+	{`\C-s`, "forward-search-history"},
+	{`\C-t`, "transpose-chars"},
+	{`\C-u`, "unix-line-discard"},
+	{`\C-w`, "unix-word-rubout"},
+	{`\C-y`, "yank"},
+	{`\e[A`, "previous-history"},
+	{`\e[B`, "next-history"},
+	{`\e[C`, "forward-char"},
+	{`\e[D`, "backward-char"},
+	{`\e[H`, "beginning-of-line"},
+	{`\e[F`, "end-of-line"},
+	{`\e[3~`, "delete-char"},
+}
+
+var viCommandBindings = []struct {
+	seq  string
+	name string
+}{
+	{`\C-c`, "interrupt"},
+	{`\C-d`, "end-of-file"},
+	{`\C-j`, "accept-line"},
+	{`\C-m`, "accept-line"},
+	{`\C-l`, "clear-screen"},
+	{`\C-r`, "reverse-search-history"},
+	{`\C-s`, "forward-search-history"},
+	{`\e[A`, "previous-history"},
+	{`\e[B`, "next-history"},
+	{`\e[C`, "forward-char"},
+	{`\e[D`, "backward-char"},
+	{`\e[H`, "beginning-of-line"},
+	{`\e[F`, "end-of-line"},
+	{`\e[3~`, "vi-delete"},
+	{`\e[200~`, "bracketed-paste-begin"},
+	{`h`, "backward-char"},
+	{`\C-h`, "backward-char"},
+	{`\C-?`, "backward-char"},
+	{`l`, "forward-char"},
+	{` `, "forward-char"},
+	{`$`, "end-of-line"},
+	{`^`, "vi-first-print"},
+	{`w`, "vi-next-word"},
+	{`W`, "vi-next-word"},
+	{`b`, "vi-prev-word"},
+	{`B`, "vi-prev-word"},
+	{`e`, "vi-end-word"},
+	{`E`, "vi-end-word"},
+	{`f`, "vi-char-search"},
+	{`F`, "vi-char-search"},
+	{`t`, "vi-char-search"},
+	{`T`, "vi-char-search"},
+	{`;`, "vi-char-search"},
+	{`,`, "vi-char-search"},
+	{`0`, "vi-arg-digit"},
+	{`1`, "vi-arg-digit"},
+	{`2`, "vi-arg-digit"},
+	{`3`, "vi-arg-digit"},
+	{`4`, "vi-arg-digit"},
+	{`5`, "vi-arg-digit"},
+	{`6`, "vi-arg-digit"},
+	{`7`, "vi-arg-digit"},
+	{`8`, "vi-arg-digit"},
+	{`9`, "vi-arg-digit"},
+	{`i`, "vi-insertion-mode"},
+	{`a`, "vi-append-mode"},
+	{`I`, "vi-insert-beg"},
+	{`A`, "vi-append-eol"},
+	{`x`, "vi-delete"},
+	{`X`, "vi-rubout"},
+	{`s`, "vi-subst"},
+	{`S`, "vi-subst"},
+	{`r`, "vi-change-char"},
+	{`~`, "vi-change-case"},
+	{`d`, "vi-delete-to"},
+	{`D`, "vi-delete-to"},
+	{`c`, "vi-change-to"},
+	{`C`, "vi-change-to"},
+	{`y`, "vi-yank-to"},
+	{`Y`, "vi-yank-to"},
+	{`p`, "vi-put"},
+	{`P`, "vi-put"},
+	{`.`, "vi-redo"},
+	{`u`, "undo"},
+	{`/`, "vi-search"},
+	{`?`, "vi-search"},
+	{`n`, "vi-search-again"},
+	{`N`, "vi-search-again"},
+	{`k`, "previous-history"},
+	{`-`, "previous-history"},
+	{`j`, "next-history"},
+	{`+`, "next-history"},
+}
+
+// ViInsertKeymap returns a new keymap holding the default bindings of vi
+// insert mode.
+func ViInsertKeymap() *Keymap {
+	m := NewKeymap()
+	for _, b := range viInsertBindings {
+		if err := m.Bind(b.seq, b.name); err != nil {
+			panic(err)
+		}
+	}
+	return m
+}
+
+// ViCommandKeymap returns a new keymap holding the default bindings of vi
+// command mode. Unbound keys are ignored instead of inserted.
+func ViCommandKeymap() *Keymap {
+	m := NewKeymap()
+	m.noInsert = true
+	for _, b := range viCommandBindings {
+		if err := m.Bind(b.seq, b.name); err != nil {
+			panic(err)
+		}
+	}
+	return m
+}
+
+type cursorShape int
+
+const (
+	cursorDefault cursorShape = iota
+	cursorBar
+	cursorBlock
+)
+
+// viClass classifies r for vi word motions: 0 for blanks, 1 for word
+// characters and 2 for other punctuation. With big set every non-blank is
+// a word character, as for W, B and E.
+func viClass(r rune, big bool) int {
+	switch {
+	case unicode.IsSpace(r):
+		return 0
+	case big || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		return 1
+	}
+	return 2
+}
+
+// The vi word motions step over grapheme clusters, classed by their first
+// rune.
+
+// viNextWord returns the start of the word after pos.
+func viNextWord(input []rune, pos int, big bool) int {
+	t := runeSlice(input)
+	if pos < len(input) {
+		if cls := viClass(input[pos], big); cls != 0 {
+			for pos < len(input) && viClass(input[pos], big) == cls {
+				pos = nextGrapheme(t, pos)
+			}
+		}
+	}
+	for pos < len(input) && viClass(input[pos], big) == 0 {
+		pos = nextGrapheme(t, pos)
+	}
+	return pos
+}
+
+// viPrevWord returns the start of the word before pos.
+func viPrevWord(input []rune, pos int, big bool) int {
+	t := runeSlice(input)
+	for pos > 0 && viClass(input[prevGrapheme(t, pos)], big) == 0 {
+		pos = prevGrapheme(t, pos)
+	}
+	if pos > 0 {
+		cls := viClass(input[prevGrapheme(t, pos)], big)
+		for pos > 0 && viClass(input[prevGrapheme(t, pos)], big) == cls {
+			pos = prevGrapheme(t, pos)
+		}
+	}
+	return pos
+}
+
+// viEndWord returns the position of the last character of the word ending
+// after pos.
+func viEndWord(input []rune, pos int, big bool) int {
+	t := runeSlice(input)
+	next := nextGrapheme(t, pos)
+	if next >= len(input) {
+		return pos
+	}
+	pos = next
+	for viClass(input[pos], big) == 0 {
+		if next = nextGrapheme(t, pos); next >= len(input) {
+			break
+		}
+		pos = next
+	}
+	cls := viClass(input[pos], big)
+	for {
+		if next = nextGrapheme(t, pos); next >= len(input) || viClass(input[next], big) != cls {
+			break
+		}
+		pos = next
+	}
+	return pos
+}
+
+// viCharSearch finds the count'th occurrence of r from pos. kind is one
+// of f, F, t or T. repeat is set for ; and , so that t and T move past the
+// character they stopped before.
+func viCharSearch(input []rune, pos int, kind byte, r rune, count int, repeat bool) (int, bool) {
+	step := 1
+	if kind == 'F' || kind == 'T' {
+		step = -1
+	}
+	i := pos
+	for ; count > 0; count-- {
+		i += step
+		if repeat && (kind == 't' || kind == 'T') && i >= 0 && i < len(input) && input[i] == r && i == pos+step {
+			i += step
+		}
+		for i >= 0 && i < len(input) && input[i] != r {
+			i += step
+		}
+		if i < 0 || i >= len(input) {
+			return pos, false
+		}
+	}
+	switch kind {
+	case 't':
+		i--
+	case 'T':
+		i++
+	}
+	return i, true
+}
+
+// viMotion returns where the motion started by k moves the cursor. When
+// inclusive is set an operator also acts on the character at pos.
+func (e *Editor) viMotion(k Key, count int) (pos int, inclusive bool, ok bool) {
+	cur := e.c.cursor_x
+	if k.Code != KeyRune || k.Ctrl || k.Alt {
+		switch k {
+		case Key{Code: KeyLeft}, Key{Code: KeyBackspace}:
+			k = Key{Rune: 'h'}
+		case Key{Code: KeyRight}:
+			k = Key{Rune: 'l'}
+		case Key{Code: KeyHome}:
+			k = Key{Rune: '0'}
+		case Key{Code: KeyEnd}:
+			k = Key{Rune: '$'}
+		default:
+			return cur, false, false
+		}
+	}
+
+	switch k.Rune {
+	case 'h':
+		return moveGraphemes(&e.c.input, cur, -count), false, true
+	case 'l', ' ':
+		return moveGraphemes(&e.c.input, cur, count), false, true
+	case '0':
+		return 0, false, true
+	case '^':
+		return firstNonBlank(&e.c.input), false, true
+	case '$':
+		return e.c.input.len(), false, true
+	}
+
+	// The word motions and character searches read the line as a slice.
+	input := e.c.input.runes()
+	switch k.Rune {
+	case 'w', 'W':
+		for ; count > 0; count-- {
+			cur = viNextWord(input, cur, k.Rune == 'W')
+		}
+		return cur, false, true
+	case 'b', 'B':
+		for ; count > 0; count-- {
+			cur = viPrevWord(input, cur, k.Rune == 'B')
+		}
+		return cur, false, true
+	case 'e', 'E':
+		for ; count > 0; count-- {
+			cur = viEndWord(input, cur, k.Rune == 'E')
+		}
+		return cur, true, true
+	case 'f', 'F', 't', 'T':
+		target, ok := e.nextKey()
+		if !ok || target.Code != KeyRune || target.Ctrl || target.Alt {
+			return cur, false, false
+		}
+		e.viSearchKind, e.viSearchRune = byte(k.Rune), target.Rune
+		pos, found := viCharSearch(input, cur, byte(k.Rune), target.Rune, count, false)
+		return pos, k.Rune == 'f' || k.Rune == 't', found
+	case ';', ',':
+		if e.viSearchKind == 0 {
+			return cur, false, false
+		}
+		kind := e.viSearchKind
+		if k.Rune == ',' {
+			kind = map[byte]byte{'f': 'F', 'F': 'f', 't': 'T', 'T': 't'}[kind]
+		}
+		pos, found := viCharSearch(input, cur, kind, e.viSearchRune, count, true)
+		return pos, kind == 'f' || kind == 't', found
+	}
+	return cur, false, false
+}
+
+func firstNonBlank(t text) int {
+	for i := 0; i < t.len(); i++ {
+		if !unicode.IsSpace(t.at(i)) {
+			return i
+		}
+	}
+	return t.len()
+}
+
+func viMotionCmd(e *Editor) {
+	if pos, _, ok := e.viMotion(e.key, e.count()); ok {
+		e.c.cursor_x = pos
+	}
+}
+
+func viArgDigit(e *Editor) {
+	if e.key.Rune == '0' && e.arg == 0 {
+		e.c.cursor_x = 0
+		return
+	}
+	e.arg = min(e.arg*10+int(e.key.Rune-'0'), maxArg)
+	e.keepArg = true
+}
+
+func viMovementMode(e *Editor) {
+	e.viCommand = true
+	e.c.cursor_x = prevGrapheme(&e.c.input, e.c.cursor_x)
+}
+
+func viInsertionMode(e *Editor) {
+	e.viCommand = false
+}
+
+func viAppendMode(e *Editor) {
+	e.c.cursor_x = nextGrapheme(&e.c.input, e.c.cursor_x)
+	e.viCommand = false
+}
+
+func viInsertBeg(e *Editor) {
+	e.c.cursor_x = firstNonBlank(&e.c.input)
+	e.viCommand = false
+}
+
+func viAppendEOL(e *Editor) {
+	e.c.cursor_x = e.c.input.len()
+	e.viCommand = false
+}
+
+func viDelete(e *Editor) {
+	e.viKill(e.c.cursor_x, moveGraphemes(&e.c.input, e.c.cursor_x, e.count()))
+}
+
+func viRubout(e *Editor) {
+	e.viKill(moveGraphemes(&e.c.input, e.c.cursor_x, -e.count()), e.c.cursor_x)
+}
+
+func viSubst(e *Editor) {
+	if e.key.Rune == 'S' {
+		e.viKill(0, e.c.input.len())
+	} else {
+		viDelete(e)
+	}
+	e.viCommand = false
+}
+
+func viChangeChar(e *Editor) {
+	k, ok := e.nextKey()
+	if !ok || k.Code != KeyRune || k.Ctrl || k.Alt {
+		return
+	}
+	n := e.count()
+	end := moveGraphemes(&e.c.input, e.c.cursor_x, n)
+	if moveGraphemes(&e.c.input, e.c.cursor_x, n-1) == end {
+		return
+	}
+	rs := make([]rune, n)
+	for i := range rs {
+		rs[i] = k.Rune
+	}
+	e.c.input.replace(e.c.cursor_x, end, rs...)
+	e.c.cursor_x += n - 1
+	e.dirty = true
+}
+
+func viChangeCase(e *Editor) {
+	for n := e.count(); n > 0 && e.c.cursor_x < e.c.input.len(); n-- {
+		r := e.c.input.at(e.c.cursor_x)
+		if unicode.IsUpper(r) {
+			r = unicode.ToLower(r)
+		} else {
+			r = unicode.ToUpper(r)
+		}
+		e.c.input.setRune(e.c.cursor_x, r)
+		e.c.cursor_x = nextGrapheme(&e.c.input, e.c.cursor_x)
+	}
+	e.dirty = true
+}
+
+// viKill deletes input[start:end] into the kill ring as a fresh entry.
+func (e *Editor) viKill(start, end int) {
+	e.lastCmd = cmdOther
+	e.kill(start, end, false)
+}
+
+// viOperatorRange reads the motion following the operator key op and
+// returns the range it covers. Doubling the operator (dd, cc, yy) selects
+// the whole line and an upper case operator (D, C, Y) the rest of it.
+func (e *Editor) viOperatorRange(op rune) (int, int, bool) {
+	cur := e.c.cursor_x
+	if unicode.IsUpper(op) {
+		return cur, e.c.input.len(), true
+	}
+
+	count := e.count()
+	k, ok := e.nextKey()
+	if !ok {
+		return 0, 0, false
+	}
+	if k.Code == KeyRune && k.Rune >= '1' && k.Rune <= '9' {
+		n := 0
+		for ok && k.Code == KeyRune && k.Rune >= '0' && k.Rune <= '9' {
+			n = min(n*10+int(k.Rune-'0'), maxArg)
+			k, ok = e.nextKey()
+		}
+		if !ok {
+			return 0, 0, false
+		}
+		count = min(count*n, maxArg)
+	}
+	if k == (Key{Rune: op}) {
+		return 0, e.c.input.len(), true
+	}
+	// cw changes to the end of the word, like vi.
+	if op == 'c' && (k.Rune == 'w' || k.Rune == 'W') && k.Code == KeyRune &&
+		cur < e.c.input.len() && !unicode.IsSpace(e.c.input.at(cur)) {
+		k.Rune += 'e' - 'w'
+	}
+
+	pos, inclusive, ok := e.viMotion(k, count)
+	if !ok {
+		return 0, 0, false
+	}
+	start, end := cur, pos
+	if pos < cur {
+		start, end = pos, cur
+	}
+	if inclusive {
+		end = nextGrapheme(&e.c.input, end)
+	}
+	return start, end, true
+}
+
+func viDeleteTo(e *Editor) {
+	if start, end, ok := e.viOperatorRange(e.key.Rune); ok {
+		e.viKill(start, end)
+	}
+}
+
+func viChangeTo(e *Editor) {
+	if start, end, ok := e.viOperatorRange(e.key.Rune); ok {
+		e.viKill(start, end)
+		e.viCommand = false
+	}
+}
+
+func viYankTo(e *Editor) {
+	start, end, ok := e.viOperatorRange(e.key.Rune)
+	if !ok || start == end {
+		return
+	}
+	if !e.password {
+		e.r.killRing = pushKill(e.r.killRing, string(e.c.input.slice(start, end)), false, false)
+	}
+	e.c.cursor_x = start
+}
+
+func viPut(e *Editor) {
+	if len(e.r.killRing) == 0 {
+		return
+	}
+	if e.key.Rune == 'p' {
+		e.c.cursor_x = nextGrapheme(&e.c.input, e.c.cursor_x)
+	}
+	for n := e.count(); n > 0; n-- {
+		e.Insert(e.r.killRing[len(e.r.killRing)-1])
+	}
+	e.c.cursor_x = prevGrapheme(&e.c.input, e.c.cursor_x)
+}
+
+// viRedo replays the keys of the last change.
+func viRedo(e *Editor) {
+	var ks []Key
+	for n := e.count(); n > 0; n-- {
+		ks = append(ks, e.viLastChange...)
+	}
+	e.keys = append(ks, e.keys...)
+}
+
+// viSearch reads a search string after / or ? and finds it in older (/)
+// or newer (?) history entries.
+func viSearch(e *Editor) {
+	q, ok := e.readString(string(e.key.Rune))
+	if !ok {
+		return
+	}
+	if q != "" {
+		e.r.lastSearch = q
+	}
+	e.viSearchBackward = e.key.Rune == '/'
+	e.viFindHistory(e.viSearchBackward)
+}
+
+func viSearchAgain(e *Editor) {
+	backward := e.viSearchBackward
+	if e.key.Rune == 'N' {
+		backward = !backward
+	}
+	e.viFindHistory(backward)
+}
+
+func (e *Editor) viFindHistory(backward bool) {
+	if e.r.lastSearch == "" || e.password {
+		return
+	}
+	q := []rune(e.r.lastSearch)
+	h := e.r.history
+	step := 1
+	if backward {
+		step = -1
+	}
+	for i := e.histIdx + step; i >= 0 && i < len(h); i += step {
+		if indexRunes([]rune(h[i]), q, 0, false) >= 0 {
+			e.historyMove(i - e.histIdx)
+			e.c.cursor_x = 0
+			return
+		}
+	}
+}
+
+// readString reads a line of text at a temporary prompt, as for the vi
+// search commands. It reports false if the user cancelled.
+func (e *Editor) readString(prompt string) (string, bool) {
+	saved, savedCursor, savedPrompt := e.c.input, e.c.cursor_x, e.c.prompt
+	defer func() {
+		e.c.input, e.c.cursor_x = saved, savedCursor
+		e.c.prompt = savedPrompt
+		e.dirty = true
+	}()
+
+	e.c.prompt = prompt
+	e.c.input, e.c.cursor_x = newBuffer(""), 0
+	e.dirty = true
+	for {
+		k, ok := e.nextKey()
+		if !ok {
+			return "", false
+		}
+		switch {
+		case k == Key{Code: KeyEnter} || k == ctrlKey('j'):
+			return e.c.input.String(), true
+		case k == Key{Code: KeyEscape} || k == ctrlKey('c') || k == ctrlKey('g'):
+			return "", false
+		case k == Key{Code: KeyBackspace}:
+			if e.c.input.len() == 0 {
+				return "", false
+			}
+			backwardDeleteChar(e)
+		case isSelfInsert(k):
+			e.c.input.insert(e.c.cursor_x, k.Rune)
+			e.c.cursor_x++
+			e.dirty = true
+		}
+	}
+}
+
+// viFinish runs after every command in vi mode. It records the keys of
+// changes for the . command and keeps the cursor on a character while in
+// command mode.
+func (e *Editor) viFinish(changed, wasCommand bool) {
+	changed = changed && e.thisCmd != cmdUndo && e.thisCmd != cmdLoad
+	switch {
+	case wasCommand && !e.viCommand:
+		// i, a, c and friends: the change lasts until Escape.
+		e.viInChange = true
+	case wasCommand && changed:
+		e.viLastChange = append([]Key(nil), e.viKeys...)
+	case !wasCommand && e.viCommand && e.viInChange:
+		e.viLastChange = append([]Key(nil), e.viKeys...)
+		e.viInChange = false
+	}
+	if e.viCommand && e.c.cursor_x >= e.c.input.len() {
+		e.c.cursor_x = prevGrapheme(&e.c.input, e.c.input.len())
+	}
+}
@@ -0,0 +1,225 @@
+package rl
+
+import "testing"
+
+var viEsc = Key{Code: KeyEscape}
+
+// viEditor returns an editor in vi insert mode at the end of input.
+func viEditor(input string) *Editor {
+	r := NewRl()
+	r.Mode = ModeVi
+	in := []rune(input)
+	return &Editor{r: r, c: &ctx{input: newBuffer(input), cursor_x: len(in)}}
+}
+
+func TestViWordMotions(t *testing.T) {
+	in := []rune("foo.bar  baz")
+	tests := []struct {
+		name string
+		got  int
+		want int
+	}{
+		{"w", viNextWord(in, 0, false), 3},
+		{"w punct", viNextWord(in, 3, false), 4},
+		{"W", viNextWord(in, 0, true), 9},
+		{"b", viPrevWord(in, 9, false), 4},
+		{"B", viPrevWord(in, 9, true), 0},
+		{"e", viEndWord(in, 0, false), 2},
+		{"E", viEndWord(in, 0, true), 6},
+		{"e across blanks", viEndWord(in, 6, false), 11},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestViCommands(t *testing.T) {
+	tests := []struct {
+		input  string
+		keys   string
+		want   string
+		cursor int
+	}{
+		{"hello world", "0dw", "world", 0},
+		{"hello world", "0cwbye", "bye world", 3},
+		{"one two three", "02dw", "three", 0},
+		{"one two three", "0d2w", "three", 0},
+		{"hello world", "dd", "", 0},
+		{"hello world", "0fwD", "hello ", 5},
+		{"hello world", "0x.", "llo world", 0},
+		{"hello world", "0dwP", "hello world", 5},
+		{"hello world", "0ywP", "hello hello world", 5},
+		{"hello", "0~~", "HEllo", 2},
+		{"hello", "0rj", "jello", 0},
+		{"a,b,c", "0f,;x", "a,bc", 3},
+		{"a,b,c", "$F,x", "a,bc", 3},
+		{"a,b,c", "0dt,", ",b,c", 0},
+		{"abc", "0ix", "xabc", 1},
+		{"abc", "Ax", "abcx", 4},
+		{"abc", "0xu", "abc", 0},
+	}
+	for _, tt := range tests {
+		e := viEditor(tt.input)
+		keys := append([]Key{viEsc}, typeKeys(tt.keys)...)
+		runKeys(e, keys...)
+		if e.c.input.String() != tt.want || e.c.cursor_x != tt.cursor {
+			t.Errorf("%q with %q = %q cursor %d, want %q cursor %d",
+				tt.input, tt.keys, e.c.input.String(), e.c.cursor_x, tt.want, tt.cursor)
+		}
+	}
+}
+
+func TestViCountIsBounded(t *testing.T) {
+	e := viEditor("hello")
+	runKeys(e, append([]Key{viEsc}, typeKeys("99999999999999999999")...)...)
+	if e.arg != maxArg {
+		t.Fatalf("arg = %d, want %d", e.arg, maxArg)
+	}
+
+	e = viEditor("hello")
+	runKeys(e, append([]Key{viEsc}, typeKeys("099999d99999999999999999999l")...)...)
+	if e.c.input.String() != "" || e.c.cursor_x != 0 {
+		t.Fatalf("got %q cursor %d, want %q cursor 0", e.c.input.String(), e.c.cursor_x, "")
+	}
+}
+
+func TestViEscapeReadWithNextKey(t *testing.T) {
+	e := viEditor("")
+	ks, _ := decodeKeys([]byte("abc\x1b0x"), true)
+	runKeys(e, ks...)
+	if e.c.input.String() != "bc" || e.c.cursor_x != 0 || !e.viCommand {
+		t.Fatalf("got %q cursor %d in command mode %v, want %q cursor 0 in command mode",
+			e.c.input.String(), e.c.cursor_x, e.viCommand, "bc")
+	}
+
+	// The change ends at the Escape, so . repeats the insert alone.
+	e = viEditor("")
+	ks, _ = decodeKeys([]byte("ia\x1b0."), true)
+	runKeys(e, append([]Key{viEsc}, ks...)...)
+	if e.c.input.String() != "aa" {
+		t.Fatalf(". after insert = %q, want %q", e.c.input.String(), "aa")
+	}
+}
+
+func TestViUndoWholeChange(t *testing.T) {
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"0cwONE\x1bu", "one two"},
+		{"0ixy z\x1bu", "one two"},
+		{"0cwONE\x1bw.u", "ONE two"},
+		{"0cwONE\x1bw.uu", "one two"},
+	}
+	for _, tt := range tests {
+		e := viEditor("one two")
+		keys := []Key{viEsc}
+		for _, k := range typeKeys(tt.keys) {
+			if k.Rune == 0x1b {
+				k = viEsc
+			}
+			keys = append(keys, k)
+		}
+		runKeys(e, keys...)
+		if e.c.input.String() != tt.want {
+			t.Errorf("%q = %q, want %q", tt.keys, e.c.input.String(), tt.want)
+		}
+	}
+}
+
+func TestViRedoInsert(t *testing.T) {
+	e := viEditor("")
+	runKeys(e, viEsc)
+	runKeys(e, typeKeys("ia-")...)
+	runKeys(e, viEsc)
+	runKeys(e, Key{Rune: '.'})
+	if e.c.input.String() != "aa--" {
+		t.Fatalf(". after insert = %q, want %q", e.c.input.String(), "aa--")
+	}
+}
+
+func TestViCommandModeIgnoresUnboundKeys(t *testing.T) {
+	e := viEditor("abc")
+	runKeys(e, viEsc, Key{Rune: 'Q'})
+	if e.c.input.String() != "abc" || e.c.cursor_x != 2 {
+		t.Fatalf("got %q cursor %d, want %q cursor 2", e.c.input.String(), e.c.cursor_x, "abc")
+	}
+}
+
+func TestViSearchHistory(t *testing.T) {
+	e := viEditor("")
+	for _, h := range []string{"git status", "ls -l", "git commit"} {
+		e.r.AddHistory(h)
+	}
+	e.histIdx = 3
+	keys := append([]Key{viEsc, {Rune: '/'}}, typeKeys("git")...)
+	runKeys(e, append(keys, Key{Code: KeyEnter})...)
+	if e.c.input.String() != "git commit" {
+		t.Fatalf("/git = %q, want %q", e.c.input.String(), "git commit")
+	}
+	runKeys(e, Key{Rune: 'n'})
+	if e.c.input.String() != "git status" {
+		t.Fatalf("n = %q, want %q", e.c.input.String(), "git status")
+	}
+}
+
+func TestReadInitFileViMode(t *testing.T) {
+	path := writeInitFile(t, t.TempDir(), "inputrc", `
+set editing-mode vi
+$if mode=vi
+"jj": vi-movement-mode
+set keymap vi-command
+"\C-a": beginning-of-line
+$endif
+`)
+
+	r := NewRl()
+	if err := r.ReadInitFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if r.Mode != ModeVi {
+		t.Fatalf("Mode = %v, want vi", r.Mode)
+	}
+	if got := boundName(t, r.ViInsertKeymap, "jj"); got != "vi-movement-mode" {
+		t.Fatalf(`"jj" bound to %q in vi-insert, want "vi-movement-mode"`, got)
+	}
+	if got := boundName(t, r.ViCommandKeymap, `\C-a`); got != "beginning-of-line" {
+		t.Fatalf(`\C-a bound to %q in vi-command, want "beginning-of-line"`, got)
+	}
+}
+
+func TestViModeInPrompt(t *testing.T) {
+	e := viEditor("abc")
+	e.r.ShowModeInPrompt = true
+	e.prompt = "$ "
+	e.updateMode()
+	if e.c.prompt != "(ins)$ " {
+		t.Fatalf("insert mode prompt = %q, want %q", e.c.prompt, "(ins)$ ")
+	}
+	e.dirty = false
+	runKeys(e, viEsc)
+	if e.c.prompt != "(cmd)$ " || !e.dirty {
+		t.Fatalf("command mode prompt = %q dirty %v, want %q dirty", e.c.prompt, e.dirty, "(cmd)$ ")
+	}
+	if e.Prompt() != "$ " {
+		t.Fatalf("Prompt() = %q, want %q", e.Prompt(), "$ ")
+	}
+}
+
+func TestReadInitFileModeStrings(t *testing.T) {
+	path := writeInitFile(t, t.TempDir(), "inputrc", `
+set show-mode-in-prompt on
+set vi-ins-mode-string "\e[1m+\e[0m "
+set vi-cmd-mode-string :
+`)
+
+	r := NewRl()
+	if err := r.ReadInitFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if !r.ShowModeInPrompt || r.ViInsModeString != "\x1b[1m+\x1b[0m " || r.ViCmdModeString != ":" {
+		t.Fatalf("got show %v ins %q cmd %q", r.ShowModeInPrompt, r.ViInsModeString, r.ViCmdModeString)
+	}
+}